@@ -1,5 +1,12 @@
 package cedar
 
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
 // Status reports the following statistics of the cedar:
 //	keys:		number of keys that are in the cedar,
 //	nodes:		number of trie nodes (slots in the base array) has been taken,
@@ -20,6 +27,127 @@ func (da *Cedar) Status() (keys, nodes, size, capacity int) {
 	return keys, nodes, da.Size, da.Capacity
 }
 
+// ResolveStats reports the number of conflicts resolved by relocating
+// the children of a node, and the number of blocks of 256 nodes added,
+// since the cedar was created. Compare them before and after a build
+// to measure how much an insertion order reduces the conflicts.
+func (da *Cedar) ResolveStats() (resolves, blocks int) {
+	return da.resolves, da.blocks
+}
+
+// Stats are the packing statistics of a cedar built by BuildStats.
+type Stats struct {
+	Keys        int     // the number of keys
+	Nodes       int     // the number of nodes in use
+	Size        int     // the size of the base array in use
+	LoadFactor  float64 // Nodes / Size
+	Relocations int     // the number of conflicts resolved by moving nodes
+}
+
+// BuildStats builds a throwaway cedar of the keys, inserted in order with
+// the given Ordered and MaxTrial, and returns how densely it is packed,
+// e.g. to compare the Size of an ordered and an unordered build.
+// It returns the error of the first key which can not be inserted.
+func BuildStats(keys [][]byte, ordered bool, maxTrial int) (Stats, error) {
+	da := New()
+	da.Ordered, da.MaxTrial = ordered, maxTrial
+	for i, key := range keys {
+		if err := da.Insert(key, i); err != nil {
+			return Stats{}, err
+		}
+	}
+
+	var s Stats
+	s.Keys, s.Nodes, s.Size, _ = da.Status()
+	s.LoadFactor = float64(s.Nodes) / float64(s.Size)
+	s.Relocations, _ = da.ResolveStats()
+	return s, nil
+}
+
+// BlockOccupancy reports the fill fraction of each block in use,
+// that is (256 - free slots) / 256 for every block of 256 nodes.
+// It can be used to decide when the trie is sparse enough to be rebuilt.
+func (da *Cedar) BlockOccupancy() []float64 {
+	occ := make([]float64, da.Size>>8)
+	for i := range occ {
+		free := da.Blocks[i].Num
+		if i == 0 {
+			// the root is counted as free in Num
+			free--
+		}
+		occ[i] = float64(256-free) / 256
+	}
+
+	return occ
+}
+
+// Fragmentation reports the ratio of free slots to all the slots
+// of the blocks in use, from 0 (fully packed) to nearly 1 (empty),
+// as the root always takes a slot.
+// As the array only grows, a ratio above about 0.5 after many deletions
+// means that rebuilding the cedar, by inserting its keys in order into
+// a new one, would at least halve its memory.
+func (da *Cedar) Fragmentation() float64 {
+	// the root is counted as free in the Num of block 0
+	free := -1
+	for i := 0; i < da.Size>>8; i++ {
+		free += da.Blocks[i].Num
+	}
+
+	return float64(free) / float64(da.Size)
+}
+
+// The nodes, node infos and blocks of the double array, exported
+// for the storage engines persisting a cedar block by block,
+// see EachBlock and LoadBlocks.
+type (
+	Node  = node
+	NInfo = ninfo
+	Block = block
+)
+
+// BlockInfo describes a block of 256 nodes of the cedar.
+type BlockInfo struct {
+	Index int // the index of the block in Blocks
+	Begin int // the first node of the block in Array
+	End   int // one past the last node of the block in Array
+	Free  int // the number of free nodes in the block
+
+	Nodes  []Node  // the nodes of the block, Array[Begin:End]
+	NInfos []NInfo // the node infos of the block, Ninfos[Begin:End]
+	Block  Block   // a copy of the block
+}
+
+// EachBlock calls fn for each block in use, in the order of Array,
+// until fn returns false. The nodes of a block are Array[Begin:End].
+// It only reads the cedar, fn must not modify it. The slices Nodes and
+// NInfos share the arrays of the cedar, they are read-only and must not
+// be retained after fn returns, e.g. copy them to write a block to a
+// page store.
+func (da *Cedar) EachBlock(fn func(b BlockInfo) bool) {
+	for i := 0; i < da.Size>>8; i++ {
+		begin, end := i<<8, (i+1)<<8
+		b := BlockInfo{
+			Index:  i,
+			Begin:  begin,
+			End:    end,
+			Free:   da.Blocks[i].Num,
+			Nodes:  da.Array[begin:end:end],
+			NInfos: da.Ninfos[begin:end:end],
+			Block:  da.Blocks[i],
+		}
+
+		if i == 0 {
+			// the root is counted as free in Num
+			b.Free--
+		}
+
+		if !fn(b) {
+			return
+		}
+	}
+}
+
 // Jump travels from a node `from` to another node
 // `to` by following the path `path`.
 // For example, if the following keys were inserted:
@@ -32,13 +160,15 @@ func (da *Cedar) Status() (keys, nodes, size, capacity int) {
 //	Jump([]byte("c"), 23) = 19, nil			// reach "abc" from "ab"
 //	Jump([]byte("cd"), 23) = 37, nil		// reach "abcd" from "ab"
 func (da *Cedar) Jump(path []byte, from int) (to int, err error) {
+	to = from
 	for _, b := range path {
-		if da.Array[from].Value >= 0 {
+		// the terminator leads to the terminal child, which is not a key
+		if b == da.term || da.Array[from].Value >= 0 {
 			return from, ErrNoPath
 		}
 
-		to = da.Array[from].base() ^ int(b)
-		if da.Array[to].Check != from {
+		to = da.Array[from].base() ^ int(da.label(b))
+		if da.Array[to].Check != from || to == 0 {
 			return from, ErrNoPath
 		}
 		from = to
@@ -47,17 +177,175 @@ func (da *Cedar) Jump(path []byte, from int) (to int, err error) {
 	return to, nil
 }
 
+// Step travels from a node `from` to its child by following
+// one byte `label`. It is Jump for a single byte, which lets
+// incremental callers keep the node between two bytes. The terminator
+// ends the keys, so it is never followed, see WithTerminator.
+func (da *Cedar) Step(from int, label byte) (to int, ok bool) {
+	if label == da.term || da.Array[from].Value >= 0 {
+		return from, false
+	}
+
+	to = da.Array[from].base() ^ int(da.label(label))
+	if da.Array[to].Check != from || to == 0 {
+		return from, false
+	}
+
+	return to, true
+}
+
+// Pin walks the subtree under the prefix, reading every node in it,
+// and returns the number of nodes. It is a latency optimization for
+// a trie whose memory is not resident yet, e.g. just loaded or swapped
+// out: it faults in the pages of a small hot namespace only, instead of
+// the whole array, before the first lookups in it. The values added by
+// InsertIn are not read, and the walk does not count as an access to
+// the keys, see WithAccessTracking; the hot prefixes are chosen by the
+// caller. It returns 0, if the prefix is not in the cedar.
+func (da *Cedar) Pin(prefix []byte) int {
+	from, err := da.Jump(prefix, 0)
+	if err != nil {
+		return 0
+	}
+
+	var visit func(from int) int
+	visit = func(from int) int {
+		n := 1
+		da.eachChild(from, func(_ byte, to int) bool {
+			n += visit(to)
+			return true
+		})
+		return n
+	}
+
+	return visit(from)
+}
+
+// JumpNode travels from a node `from` by following the key as far as
+// it can, like Jump, but it stops at the deepest node reached instead
+// of failing, whether the node has a value or not. It returns the node
+// and the number of bytes of the key followed to reach it.
+// ok is false only if the key is not empty and its first byte can not
+// be followed, then id is `from` and consumed is 0.
+func (da *Cedar) JumpNode(key []byte, from int) (id int, consumed int, ok bool) {
+	id = from
+	for _, b := range key {
+		to, ok := da.Step(id, b)
+		if !ok {
+			break
+		}
+
+		id = to
+		consumed++
+	}
+
+	return id, consumed, consumed > 0 || len(key) == 0
+}
+
+// CommonPrefixLen returns the length of the longest common prefix
+// of the keys `a` and `b`.
+func CommonPrefixLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
+
+// DeepestCommonNode returns the node where the paths of the stored keys
+// `a` and `b` diverge, i.e. the node of their longest common prefix,
+// e.g. to group the keys into a hierarchy. It is the root for the keys
+// without a common prefix, and the node of the key for equal keys.
+// ok is false, if either key is not stored.
+func (da *Cedar) DeepestCommonNode(a, b []byte) (id int, ok bool) {
+	if !da.Contains(a) || !da.Contains(b) {
+		return 0, false
+	}
+
+	id, _ = da.CommonAncestor(a, b)
+	return id, true
+}
+
+// CommonAncestor returns the deepest node on the paths of both keys,
+// which need not be stored, and its depth, i.e. the length of the prefix
+// they share in the cedar, e.g. to go on with a traversal from there.
+// It returns the root and 0, if they share no prefix in the cedar.
+func (da *Cedar) CommonAncestor(a, b []byte) (id int, depth int) {
+	id, depth, _ = da.JumpNode(a[:CommonPrefixLen(a, b)], 0)
+	return
+}
+
+// IsPrefix reports whether the path of the key, starting from the node
+// `from`, exists and goes on, i.e. the key is a strict prefix of
+// at least one longer key, whether it has a value itself or not.
+// It returns false for the unknown paths.
+func (da *Cedar) IsPrefix(key []byte, from int) bool {
+	to, err := da.Jump(key, from)
+	if err != nil {
+		return false
+	}
+
+	goesOn := false
+	da.eachChild(to, func(label byte, _ int) bool {
+		goesOn = label != 0
+		return !goesOn
+	})
+
+	return goesOn
+}
+
+// The membership predicates of a key, for the keys "ab" and "abcd":
+//
+//	Contains:   the key itself is stored, "ab" and "abcd"
+//	HasPrefix:  a stored key is a prefix of the key, "ab", "abc", "abx"...
+//	IsPrefixOf: the key is a strict prefix of a stored key, "a", "ab", "abc"
+//
+// IsPrefixOf tells whether a partial input may still become a key.
+
+// Contains reports whether the key is stored, with either kind of value.
+func (da *Cedar) Contains(key []byte) bool {
+	if validKey(key, da.term) != nil {
+		return false
+	}
+
+	to, err := da.Jump(key, 0)
+	if err != nil {
+		return false
+	}
+
+	_, ok := da.valueNode(to)
+	return ok
+}
+
+// HasPrefix reports whether a stored key, including the key itself,
+// is a prefix of the key, see Contains.
+func (da *Cedar) HasPrefix(key []byte) bool {
+	return len(da.prefixMatch(nil, key, 1)) > 0
+}
+
+// IsPrefixOf reports whether the key is a strict prefix of a longer
+// stored key, whether it is stored itself or not, see Contains.
+// It is IsPrefix from the root.
+func (da *Cedar) IsPrefixOf(key []byte) bool {
+	return da.IsPrefix(key, 0)
+}
+
 // Key returns the key of the node with the given `id`.
 // It will return ErrNoPath, if the node does not exist.
 func (da *Cedar) Key(id int) (key []byte, err error) {
+	if !da.isNode(id) {
+		return nil, ErrNoPath
+	}
+
 	for id > 0 {
 		from := da.Array[id].Check
 		if from < 0 {
 			return nil, ErrNoPath
 		}
 
-		if char := byte(da.Array[from].base() ^ id); char != 0 {
-			key = append(key, char)
+		if label := byte(da.Array[from].base() ^ id); label != 0 {
+			key = append(key, da.char(label))
 		}
 		id = from
 	}
@@ -75,7 +363,71 @@ func (da *Cedar) Key(id int) (key []byte, err error) {
 
 // Value returns the value of the node with the given `id`.
 // It will return ErrNoValue, if the node does not have a value.
+// With WithAccessTracking, it counts as an access to the key.
 func (da *Cedar) Value(id int) (value int, err error) {
+	value, err = da.value(id)
+	if err == nil {
+		da.accessed(id)
+		value = da.decoded(value)
+	}
+
+	return value, err
+}
+
+// Values returns the values of the nodes with the given ids, like Value,
+// e.g. for the ids returned by PrefixPredict. It returns no values and
+// the error of the first id without a value, if any.
+func (da *Cedar) Values(ids []int) ([]int, error) {
+	values := make([]int, len(ids))
+	for i, id := range ids {
+		value, err := da.Value(id)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+// WithValueDecoder makes the cedar return fn(value) for each stored
+// value read by Value, Values, Get, LookupBatchMasked and ForEach,
+// e.g. to store the values encoded and read them decoded. The other
+// methods, such as Update, InsertMerge, KeysForValue, Diff and Save,
+// see the stored values.
+func WithValueDecoder(fn func(value int) int) Option {
+	return func(da *Cedar) {
+		da.valueDecoder = fn
+	}
+}
+
+// decoded returns the value decoded by the value decoder, if any.
+func (da *Cedar) decoded(value int) int {
+	if da.valueDecoder == nil {
+		return value
+	}
+
+	return da.valueDecoder(value)
+}
+
+// accessed records an access to the key of the node `id`,
+// if the accesses are tracked.
+func (da *Cedar) accessed(id int) {
+	if da.recency == nil || !da.recency.access {
+		return
+	}
+
+	if key, err := da.Key(id); err == nil {
+		da.recency.touch(key)
+	}
+}
+
+// value is Value, without recording the access.
+func (da *Cedar) value(id int) (value int, err error) {
+	if !da.isNode(id) {
+		return 0, ErrNoValue
+	}
+
 	value = da.Array[id].Value
 	if value >= 0 {
 		return value, nil
@@ -89,195 +441,2101 @@ func (da *Cedar) Value(id int) (value int, err error) {
 	return 0, ErrNoValue
 }
 
-// Insert adds a key-value pair into the cedar.
-// It will return ErrInvalidValue, if value < 0 or >= ValueLimit.
-func (da *Cedar) Insert(key []byte, value int) error {
-	if value < 0 || value >= ValueLimit {
-		return ErrInvalidValue
+// IsValid reports whether the id is a node holding a value, i.e. in range,
+// not free and with a value of either kind, e.g. to check the ids cached
+// before a Load or a Compact, which move the nodes. It costs O(1).
+func (da *Cedar) IsValid(id int) bool {
+	if !da.isNode(id) {
+		return false
 	}
 
-	p := da.get(key, 0, 0)
-	*p = value
-
-	return nil
+	_, ok := da.valueNode(id)
+	return ok
 }
 
-// InsertIn adds a key-value pair into the cedar.
-// It will return ErrInvalidValue, if value < 0 or >= valueLimit.
-func (da *Cedar) InsertIn(key []byte, value interface{}) error {
-	k := da.vKey()
-	klen := len(key)
-	p := da.getV(key, 0, 0)
-
-	da.Array[p].Value = k
-	da.Ninfos[p].End = true
-	da.vals[k] = nvalue{Len: klen, Value: value}
-	return nil
+// isNode reports whether the id is a node in use.
+func (da *Cedar) isNode(id int) bool {
+	return id >= 0 && id < da.Size && da.Array[id].Check >= 0
 }
 
-// Update increases the value associated with the `key`.
-// The `key` will be inserted if it is not in the cedar.
-// It will return ErrInvalidValue, if the updated value < 0 or >= ValueLimit.
-func (da *Cedar) Update(key []byte, value int) error {
-	p := da.get(key, 0, 0)
-
-	// key was not inserted
-	if *p == ValueLimit {
-		*p = value
-		return nil
+// valueNode returns the node which holds the value of the node `id`,
+// it is either `id` itself or its terminal child.
+func (da *Cedar) valueNode(id int) (int, bool) {
+	if da.Array[id].Value >= 0 {
+		return id, true
 	}
 
-	// key was inserted before
-	if *p+value < 0 || *p+value >= ValueLimit {
-		return ErrInvalidValue
+	to := da.Array[id].base()
+	if da.Array[to].Check == id && da.Array[to].Value >= 0 {
+		return to, true
 	}
-	*p += value
 
-	return nil
+	return 0, false
 }
 
-// Delete removes a key-value pair from the cedar.
-// It will return ErrNoPath, if the key has not been added.
-func (da *Cedar) Delete(key []byte) error {
-	// if the path does not exist, or the end is not a leaf,
-	// nothing to delete
-	to, err := da.Jump(key, 0)
-	if err != nil {
-		return ErrNoPath
-	}
+// SetReadOnly marks the cedar as read-only or writable again.
+// All the mutating methods of a read-only cedar return ErrReadOnly.
+func (da *Cedar) SetReadOnly(readOnly bool) {
+	da.readOnly = readOnly
+}
 
-	if da.Array[to].Value < 0 {
-		base := da.Array[to].base()
-		if da.Array[base].Check == to {
-			to = base
-		}
+// ReadOnly reports whether the cedar is read-only.
+func (da *Cedar) ReadOnly() bool {
+	return da.readOnly
+}
+
+// writable guards all the mutating methods.
+func (da *Cedar) writable() error {
+	if da.readOnly {
+		return ErrReadOnly
 	}
 
-	for to > 0 {
-		from := da.Array[to].Check
-		base := da.Array[from].base()
-		label := byte(to ^ base)
+	return nil
+}
 
-		// if `to` has sibling, remove `to` from the sibling list, then stop
-		if da.Ninfos[to].Sibling != 0 || da.Ninfos[from].Child != label {
-			// delete the label from the child ring first
-			da.popSibling(from, base, label)
-			// then release the current node `to` to the empty node ring
-			da.pushEnode(to)
-			break
-		}
+// OnInsert sets the hook called after each successful Insert or Update
+// with the key and its new value, nil removes it. InsertIn does not
+// call it, as its values are not integers. The hook runs synchronously,
+// under any lock held by the caller, and must not modify the cedar.
+// The key is only valid during the call.
+func (da *Cedar) OnInsert(fn func(key []byte, value int)) {
+	da.onInsert = fn
+}
 
-		// otherwise, just release the current node `to` to the empty node ring
-		da.pushEnode(to)
-		// then check its parent node
-		to = from
-	}
+// OnDelete sets the hook called after each successful Delete
+// with the deleted key, nil removes it. The hook runs synchronously,
+// under any lock held by the caller, and must not modify the cedar.
+// The key is only valid during the call.
+func (da *Cedar) OnDelete(fn func(key []byte)) {
+	da.onDelete = fn
+}
 
-	return nil
+// OnGrow sets the hook called after each reallocation of the arrays
+// of the cedar, with the capacity in nodes before and after it, nil
+// removes it. The hook runs synchronously in the middle of an insertion,
+// and must not access the cedar.
+func (da *Cedar) OnGrow(fn func(oldCap, newCap int)) {
+	da.onGrow = fn
 }
 
-// Get returns the value associated with the given `key`.
-// It is equivalent to
-//		id, err1 = Jump(key)
-//		value, err2 = Value(id)
-// Thus, it may return ErrNoPath or ErrNoValue,
-func (da *Cedar) Get(key []byte) (value int, err error) {
-	to, err := da.Jump(key, 0)
-	if err != nil {
-		return 0, err
-	}
+// ArrayCapacity returns the number of nodes allocated by the cedar,
+// like the Capacity field, which must not be modified.
+func (da *Cedar) ArrayCapacity() int {
+	return da.Capacity
+}
 
-	return da.Value(to)
+// ArraySize returns the number of nodes in the blocks in use by
+// the cedar, like the Size field, which must not be modified.
+func (da *Cedar) ArraySize() int {
+	return da.Size
 }
 
-// PrefixMatch returns a list of at most `num` nodes
-// which match the prefix of the key.
-// If `num` is 0, it returns all matches.
-// For example, if the following keys were inserted:
-//	id	key
-//	19	abc
-//	23	ab
-//	37	abcd
-// then
-//	PrefixMatch([]byte("abc"), 1) = [ 23 ]				// match ["ab"]
-//	PrefixMatch([]byte("abcd"), 0) = [ 23, 19, 37]
-// match ["ab", "abc", "abcd"]
-func (da *Cedar) PrefixMatch(key []byte, num int) (ids []int) {
-	for from, i := 0, 0; i < len(key); i++ {
-		to, err := da.Jump(key[i:i+1], from)
-		if err != nil {
-			break
+// NodeIDRange returns the smallest and the largest ids of the nodes
+// in use, but the root, e.g. to size an array indexed by the ids.
+// The ids are not dense, except after Compact, and only the ones below
+// ArraySize can be in use. It returns 0, 0 for an empty cedar, as 0 is
+// the root. It scans all the nodes.
+func (da *Cedar) NodeIDRange() (min, max int) {
+	for id := 1; id < da.Size; id++ {
+		if da.Array[id].Check < 0 {
+			continue
 		}
 
-		if _, err := da.Value(to); err == nil {
-			ids = append(ids, to)
-			num--
-			if num == 0 {
-				return
-			}
+		if min == 0 {
+			min = id
 		}
-
-		from = to
+		max = id
 	}
 
 	return
 }
 
-// PrefixPredict returns a list of at most `num` nodes
-// which has the key as their prefix.
-// These nodes are ordered by their keys.
-// If `num` is 0, it returns all matches.
-// For example, if the following keys were inserted:
-//	id	key
-//	19	abc
-//	23	ab
-//	37	abcd
-// then
-//	PrefixPredict([]byte("ab"), 2) = [ 23, 19 ]			// predict ["ab", "abc"]
-//	PrefixPredict([]byte("ab"), 0) = [ 23, 19, 37 ]
-// predict ["ab", "abc", "abcd"]
-func (da *Cedar) PrefixPredict(key []byte, num int) (ids []int) {
-	root, err := da.Jump(key, 0)
-	if err != nil {
-		return
+// ValueIn returns the value added by InsertIn of the node with the given `id`.
+// It will return ErrNoValue, if the node does not have such a value.
+// With WithAccessTracking, it counts as an access to the key.
+func (da *Cedar) ValueIn(id int) (value interface{}, err error) {
+	if !da.isNode(id) {
+		return nil, ErrNoValue
 	}
 
-	for from, err := da.begin(root); err == nil; from, err = da.next(from, root) {
-		ids = append(ids, from)
-		num--
-		if num == 0 {
-			return
-		}
+	to, ok := da.valueNode(id)
+	if !ok || !da.Ninfos[to].End {
+		return nil, ErrNoValue
 	}
 
-	return
+	da.accessed(id)
+	return da.vals[da.Array[to].Value].Value, nil
 }
 
-func (da *Cedar) begin(from int) (to int, err error) {
-	for c := da.Ninfos[from].Child; c != 0; {
-		to = da.Array[from].base() ^ int(c)
-		c = da.Ninfos[to].Child
-		from = to
+// ValueLen returns the length stored along with the value added by
+// InsertIn or InsertInLen of the node with the given `id`.
+// It will return ErrNoValue, if the node does not have such a value.
+func (da *Cedar) ValueLen(id int) (int, error) {
+	if !da.isNode(id) {
+		return 0, ErrNoValue
 	}
 
-	if da.Array[from].base() > 0 {
-		return da.Array[from].base(), nil
+	to, ok := da.valueNode(id)
+	if !ok || !da.Ninfos[to].End {
+		return 0, ErrNoValue
 	}
 
-	return from, nil
+	return da.vals[da.Array[to].Value].Len, nil
 }
 
-func (da *Cedar) next(from int, root int) (to int, err error) {
-	c := da.Ninfos[from].Sibling
-	for c == 0 && from != root && da.Array[from].Check >= 0 {
-		from = da.Array[from].Check
-		c = da.Ninfos[from].Sibling
+// ValueBytes returns the size in bytes of the values added by InsertIn,
+// e.g. to account for the memory of the values stored out of the nodes,
+// while the values of Insert are held by the nodes and add nothing.
+// The strings and the byte slices count their length, and all the other
+// types their own size, e.g. 8 for an int64 on any platform, but not
+// what they point to. The map and its entries are not counted.
+// It costs a scan over the values.
+func (da *Cedar) ValueBytes() (n int) {
+	for _, v := range da.vals {
+		switch value := v.Value.(type) {
+		case nil:
+		case string:
+			n += len(value)
+		case []byte:
+			n += len(value)
+		default:
+			n += int(reflect.TypeOf(value).Size())
+		}
 	}
 
-	if from == root {
-		return 0, ErrNoPath
+	return
+}
+
+// Insert adds a key-value pair into the cedar.
+// It will return ErrInvalidValue, if value < 0 or >= ValueLimit,
+// and ErrInvalidKey, if the key contains the terminator, see WithTerminator.
+func (da *Cedar) Insert(key []byte, value int) error {
+	return da.insert(key, value, nil)
+}
+
+// InsertFunc is like Insert, but pulls the bytes of the key from `next`
+// until it returns false, e.g. for a key joined from several pieces,
+// following each byte as it comes. The key is only gathered into a slice
+// for OnInsert, WithValueIndex, WithInsertOrder and WithCapacityLimit,
+// which refer to the whole key. The nodes added for a key which turns out
+// to be invalid are released, see LookupFunc.
+func (da *Cedar) InsertFunc(next func() (byte, bool), value int) error {
+	if err := da.writable(); err != nil {
+		return err
 	}
-	from = da.Array[da.Array[from].Check].base() ^ int(c)
 
-	return da.begin(from)
+	if value < 0 || value >= ValueLimit {
+		return ErrInvalidValue
+	}
+
+	var key []byte
+	gather := da.onInsert != nil || da.index != nil ||
+		da.insertOrder != nil || da.recency != nil
+
+	da.cache.clear()
+	from, n := 0, 0
+	for b, ok := next(); ok; b, ok = next() {
+		n++
+		var err error
+		if b == da.term {
+			err = ErrInvalidKey
+		} else if da.maxKeyLen > 0 && n > da.maxKeyLen {
+			for _, ok := next(); ok; _, ok = next() {
+				n++
+			}
+			err = ErrKeyTooLong{Len: n, Max: da.maxKeyLen}
+		}
+
+		if err != nil {
+			if da.Array[from].Value == ValueLimit {
+				da.release(from)
+			}
+			return err
+		}
+
+		if from, err = da.followKey(from, da.label(b)); err != nil {
+			return err
+		}
+		if gather {
+			key = append(key, b)
+		}
+	}
+
+	p, err := da.terminal(from)
+	if err != nil {
+		return err
+	}
+
+	return da.insertAt(p, key, value, nil)
+}
+
+// InsertWith adds a key-value pair into the cedar like Insert,
+// and stores `display` along with it, e.g. the original form of a key
+// which was case folded or stripped of its diacritics before, returned
+// by Display. Key still returns the inserted key. The display forms are
+// dropped with their keys, and they are not saved.
+func (da *Cedar) InsertWith(key []byte, value int, display []byte) error {
+	if err := da.Insert(key, value); err != nil {
+		return err
+	}
+
+	if da.display == nil {
+		da.display = make(map[string][]byte)
+	}
+	da.display[string(key)] = append([]byte(nil), display...)
+	return nil
+}
+
+// Display returns the display form stored by InsertWith
+// of the key of the node `id`.
+func (da *Cedar) Display(id int) ([]byte, bool) {
+	if len(da.display) == 0 {
+		return nil, false
+	}
+
+	key, err := da.Key(id)
+	if err != nil {
+		return nil, false
+	}
+
+	display, ok := da.display[string(key)]
+	return display, ok
+}
+
+// InsertMerge adds a key-value pair into the cedar like Insert, but if
+// the key was added before by Insert or Update, it stores
+// merge(old, value) instead, e.g. to sum or keep the maximum of
+// the values of duplicate keys. It follows the key only once.
+// It will return ErrInvalidValue, if the stored value < 0 or >= ValueLimit.
+func (da *Cedar) InsertMerge(key []byte, value int,
+	merge func(old, new int) int) error {
+	return da.insert(key, value, merge)
+}
+
+// AutoValue returns the value of the key like Get, if the key was
+// added by Insert or Update, otherwise it inserts the key with the next
+// sequential value, one more than the largest value ever inserted,
+// and returns it. It is meant for a symbol table mapping each key to
+// a dense id: the values are stored in the nodes of the keys,
+// so the ids take no space besides the trie.
+// It will return ErrInvalidKey, if the key contains the terminator,
+// see WithTerminator.
+func (da *Cedar) AutoValue(key []byte) (int, error) {
+	if err := da.checkKey(key); err != nil {
+		return 0, err
+	}
+
+	if value, err := da.Get(key); err == nil {
+		return value, nil
+	}
+
+	value := da.nextValue
+	if err := da.Insert(key, value); err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// used records that the value has been inserted, for AutoValue.
+func (da *Cedar) used(value int) {
+	if value >= da.nextValue {
+		da.nextValue = value + 1
+	}
+}
+
+func (da *Cedar) insert(key []byte, value int,
+	merge func(old, new int) int) error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	if err := da.checkKey(key); err != nil {
+		return err
+	}
+
+	if value < 0 || value >= ValueLimit {
+		return ErrInvalidValue
+	}
+
+	da.cache.clear()
+	p, err := da.getV(key, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return da.insertAt(p, key, value, merge)
+}
+
+// insertAt sets the value of the key to the node `p` of its value.
+func (da *Cedar) insertAt(p int, key []byte, value int,
+	merge func(old, new int) int) error {
+	old := da.Array[p].Value
+	if merge != nil && old != ValueLimit && !da.Ninfos[p].End {
+		value = merge(old, value)
+		if value < 0 || value >= ValueLimit {
+			return ErrInvalidValue
+		}
+	}
+
+	if old == ValueLimit {
+		da.added(key)
+	} else if !da.Ninfos[p].End {
+		da.indexRemove(key, old)
+	} else {
+		da.freeVal(old)
+	}
+	da.Array[p].Value = value
+	da.Ninfos[p].End = false
+	da.indexAdd(key, value)
+	da.used(value)
+
+	if da.onInsert != nil {
+		da.onInsert(key, value)
+	}
+	da.inserted(key)
+	return nil
+}
+
+// InsertIn adds a key-value pair into the cedar.
+// It will return ErrInvalidKey, if the key contains the terminator,
+// see WithTerminator.
+// The length of the key is stored along with the value, see ValueLen.
+func (da *Cedar) InsertIn(key []byte, value interface{}) error {
+	return da.InsertInLen(key, value, len(key))
+}
+
+// InsertInLen is like InsertIn, but stores the given `length` along
+// with the value instead of the length of the key, e.g. the length
+// of the original key before it was normalized.
+func (da *Cedar) InsertInLen(key []byte, value interface{}, length int) error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	if err := da.checkKey(key); err != nil {
+		return err
+	}
+
+	da.cache.clear()
+	p, err := da.getV(key, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	k := da.vKey()
+	if old := da.Array[p].Value; old == ValueLimit {
+		da.added(key)
+	} else if !da.Ninfos[p].End {
+		da.indexRemove(key, old)
+	} else {
+		da.freeVal(old)
+	}
+
+	da.Array[p].Value = k
+	da.Ninfos[p].End = true
+	da.vals[k] = nvalue{Len: length, Value: value}
+	da.inserted(key)
+	return nil
+}
+
+// KV is a key-value pair.
+type KV struct {
+	Key   []byte
+	Value int
+}
+
+// InsertChan inserts the key-value pairs received from `ch`
+// until it is closed. The pairs are consumed by the calling goroutine only.
+// It returns the first error of Insert, the following pairs are
+// still drained from `ch` but not inserted, so the producer never blocks.
+func (da *Cedar) InsertChan(ch <-chan KV) (err error) {
+	for kv := range ch {
+		if err != nil {
+			continue
+		}
+
+		err = da.Insert(kv.Key, kv.Value)
+	}
+
+	if err != nil {
+		return
+	}
+
+	return da.loaded()
+}
+
+// InsertSorted adds a key-value pair into the cedar, like Insert,
+// for keys coming in ascending byte order.
+// It will return ErrNotSorted, if the key is not strictly greater
+// than the key of the previous InsertSorted, until Clear is called.
+func (da *Cedar) InsertSorted(key []byte, value int) error {
+	if da.sorted && bytes.Compare(key, da.lastKey) <= 0 {
+		return ErrNotSorted
+	}
+
+	if err := da.Insert(key, value); err != nil {
+		return err
+	}
+
+	da.lastKey = append(da.lastKey[:0], key...)
+	da.sorted = true
+	return nil
+}
+
+// Clear removes all the keys from the cedar,
+// keeping its settings such as Ordered and MaxTrial.
+func (da *Cedar) Clear() error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	n := New()
+	if da.alloc != nil {
+		WithAllocator(da.alloc)(n)
+	}
+	da.setStorage(n)
+
+	da.cache.clear()
+	da.lastKey, da.sorted = nil, false
+	da.nextValue, da.display = 0, nil
+	da.indexRebuild()
+	da.recencyRebuild()
+	da.insertOrderRebuild()
+	return nil
+}
+
+// setStorage replaces the nodes and the values of the cedar
+// with those of `n`, keeping its settings. The nodes of `n` are copied
+// into arrays of the allocator of the cedar, if `n` has another one,
+// e.g. when `n` was loaded.
+func (da *Cedar) setStorage(n *Cedar) {
+	capacity := n.Capacity
+	if da.fixed && capacity < da.maxCapacity {
+		capacity = da.maxCapacity
+	}
+
+	if capacity != n.Capacity || n.alloc != da.alloc {
+		n.alloc = da.alloc
+		n.grow(capacity)
+	}
+
+	da.Array, da.Ninfos, da.Blocks, da.Reject = n.Array, n.Ninfos, n.Blocks, n.Reject
+	da.vals, da.vkey, da.vfree = n.vals, n.vkey, n.vfree
+	da.BheadF, da.BheadC, da.BheadO = n.BheadF, n.BheadC, n.BheadO
+	da.Capacity, da.Size = n.Capacity, n.Size
+	da.keys = n.keys
+}
+
+// Update increases the value associated with the `key`.
+// The `key` will be inserted if it is not in the cedar.
+// It will return ErrInvalidValue, if the updated value < 0 or >= ValueLimit,
+// and ErrInvalidKey, if the key contains the terminator, see WithTerminator.
+func (da *Cedar) Update(key []byte, value int) error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	if err := da.checkKey(key); err != nil {
+		return err
+	}
+
+	da.cache.clear()
+	to, err := da.getV(key, 0, 0)
+	if err != nil {
+		return err
+	}
+	p := &da.Array[to].Value
+
+	// key was not inserted
+	if *p == ValueLimit {
+		*p = value
+		da.added(key)
+	} else {
+		// key was inserted before
+		if *p+value < 0 || *p+value >= ValueLimit {
+			return ErrInvalidValue
+		}
+
+		if !da.Ninfos[to].End {
+			da.indexRemove(key, *p)
+		}
+		*p += value
+	}
+
+	if !da.Ninfos[to].End {
+		da.indexAdd(key, *p)
+		da.used(*p)
+	}
+
+	if da.onInsert != nil {
+		da.onInsert(key, *p)
+	}
+	da.inserted(key)
+	return nil
+}
+
+// Delete removes a key-value pair from the cedar.
+// It will return ErrNoPath, if the key has not been added.
+func (da *Cedar) Delete(key []byte) error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	// if the path does not exist, or the end is not a leaf,
+	// nothing to delete
+	to, err := da.Jump(key, 0)
+	if err != nil {
+		return ErrNoPath
+	}
+
+	// the key is only a prefix of other keys
+	to, ok := da.valueNode(to)
+	if !ok {
+		return ErrNoPath
+	}
+	da.cache.clear()
+
+	if !da.Ninfos[to].End {
+		da.indexRemove(key, da.Array[to].Value)
+	} else {
+		da.freeVal(da.Array[to].Value)
+	}
+	da.removed(key)
+
+	da.release(to)
+
+	if da.onDelete != nil {
+		da.onDelete(key)
+	}
+	return nil
+}
+
+// added records a new key.
+func (da *Cedar) added(key []byte) {
+	da.keys++
+	da.insertOrder.add(key)
+}
+
+// removed records the deletion of a key.
+func (da *Cedar) removed(key []byte) {
+	da.keys--
+	delete(da.display, string(key))
+	da.recency.remove(key)
+	da.insertOrder.remove(key)
+}
+
+// release releases the node `to` and its ancestors which have no other child.
+func (da *Cedar) release(to int) {
+	for to > 0 {
+		from := da.Array[to].Check
+		base := da.Array[from].base()
+		label := byte(to ^ base)
+
+		// if `to` has sibling, remove `to` from the sibling list, then stop
+		if da.Ninfos[to].Sibling != 0 || da.Ninfos[from].Child != label {
+			// delete the label from the child ring first
+			da.popSibling(from, base, label)
+			// then release the current node `to` to the empty node ring
+			da.pushEnode(to)
+			break
+		}
+
+		// otherwise, just release the current node `to` to the empty node ring
+		da.pushEnode(to)
+		if from == 0 {
+			// the root is never released, forget its last child
+			da.Ninfos[0].Child = 0
+		}
+		// then check its parent node
+		to = from
+	}
+}
+
+// Get returns the value associated with the given `key`.
+// It is equivalent to
+//		id, err1 = Jump(key)
+//		value, err2 = Value(id)
+// Thus, it may return ErrNoPath or ErrNoValue,
+func (da *Cedar) Get(key []byte) (value int, err error) {
+	to, err := da.Jump(key, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err = da.value(to)
+	if err != nil {
+		return 0, err
+	}
+
+	if da.recency != nil && da.recency.access {
+		da.recency.touch(key)
+	}
+
+	return da.decoded(value), nil
+}
+
+// LookupFunc is like Get, but pulls the bytes of the key from `next`
+// until it returns false, following each byte as it comes, so the key
+// is never gathered into a slice. It stops pulling at the first byte
+// which can not be followed, and returns ErrNoPath. Unlike Get, it does
+// not count as an access to the key, as it does not know the whole key.
+func (da *Cedar) LookupFunc(next func() (byte, bool)) (value int, err error) {
+	to := 0
+	for b, ok := next(); ok; b, ok = next() {
+		child, stepped := da.Step(to, b)
+		if !stepped {
+			return 0, ErrNoPath
+		}
+		to = child
+	}
+
+	value, err = da.value(to)
+	if err != nil {
+		return 0, err
+	}
+
+	return da.decoded(value), nil
+}
+
+// LookupFull returns the value of the key, like Get, and the length
+// stored along with it, in one walk. The length is the one stored by
+// InsertIn or InsertInLen, and the length of the key for the keys added
+// by Insert. It returns 0, 0, false, if the key has no value, and for
+// the keys added by InsertIn, which have no int value: their value and
+// length are read by ValueIn and ValueLen. It is read-only, and it does
+// not count as an access to the key.
+func (da *Cedar) LookupFull(key []byte) (value int, length int, found bool) {
+	to, err := da.Jump(key, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	to, ok := da.valueNode(to)
+	if !ok {
+		return 0, 0, false
+	}
+
+	if da.Ninfos[to].End {
+		return 0, 0, false
+	}
+
+	return da.decoded(da.Array[to].Value), len(key), true
+}
+
+// LookupBatchMasked returns the values of the keys, position-aligned
+// with `keys`, and whether each key was found, as 0 is a valid value.
+// The keys are walked in byte order, each one from the node of the prefix
+// it shares with the previous one, so the shared prefixes of the batch
+// are walked once. The accesses are still counted in the order of `keys`.
+func (da *Cedar) LookupBatchMasked(keys [][]byte) (values []int, found []bool) {
+	values = make([]int, len(keys))
+	found = make([]bool, len(keys))
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	// path holds the nodes of the prefixes of the previous key
+	// which are in the cedar, from the root.
+	path := []int{0}
+	var prev []byte
+	for _, i := range order {
+		key := keys[i]
+		n := CommonPrefixLen(prev, key)
+		if n >= len(path) {
+			n = len(path) - 1
+		}
+		path, prev = path[:n+1], key
+
+		for _, b := range key[n:] {
+			to, ok := da.Step(path[len(path)-1], b)
+			if !ok {
+				break
+			}
+			path = append(path, to)
+		}
+
+		if len(path) != len(key)+1 {
+			continue
+		}
+
+		if value, err := da.value(path[len(key)]); err == nil {
+			values[i], found[i] = da.decoded(value), true
+		}
+	}
+
+	if da.recency != nil && da.recency.access {
+		for i, key := range keys {
+			if found[i] {
+				da.recency.touch(key)
+			}
+		}
+	}
+
+	return
+}
+
+// PrefixMatch returns a list of at most `num` nodes
+// which match the prefix of the key.
+// If `num` is 0, it returns all matches.
+// For example, if the following keys were inserted:
+//	id	key
+//	19	abc
+//	23	ab
+//	37	abcd
+// then
+//	PrefixMatch([]byte("abc"), 1) = [ 23 ]				// match ["ab"]
+//	PrefixMatch([]byte("abcd"), 0) = [ 23, 19, 37]
+// match ["ab", "abc", "abcd"]
+func (da *Cedar) PrefixMatch(key []byte, num int) (ids []int) {
+	return da.prefixMatch(nil, key, num)
+}
+
+// prefixMatch appends the matches of PrefixMatch to ids.
+func (da *Cedar) prefixMatch(ids []int, key []byte, num int) []int {
+	for from, i := 0, 0; i < len(key); i++ {
+		to, err := da.Jump(key[i:i+1], from)
+		if err != nil {
+			break
+		}
+
+		if _, err := da.value(to); err == nil {
+			ids = append(ids, to)
+			num--
+			if num == 0 {
+				return ids
+			}
+		}
+
+		from = to
+	}
+
+	return ids
+}
+
+// PrefixMatchBatch returns the PrefixMatch of all the keys, so that
+// matches[i] is PrefixMatch(keys[i], 0). The results share one buffer,
+// which saves an allocation per key when classifying many short keys.
+func (da *Cedar) PrefixMatchBatch(keys [][]byte) (matches [][]int) {
+	matches = make([][]int, len(keys))
+
+	var buf []int
+	for i, key := range keys {
+		start := len(buf)
+		buf = da.prefixMatch(buf, key, 0)
+		if len(buf) > start {
+			// cap the slice, so appending to it never overwrites the next
+			matches[i] = buf[start:len(buf):len(buf)]
+		}
+	}
+
+	return
+}
+
+// PrefixMatchLens is like PrefixMatch, but starts from the node `from`
+// and also returns the length of each matched prefix,
+// so that lens[i] is the number of bytes of the key matched by ids[i].
+func (da *Cedar) PrefixMatchLens(key []byte, from int) (ids, lens []int) {
+	for i := 0; i < len(key); i++ {
+		to, err := da.Jump(key[i:i+1], from)
+		if err != nil {
+			break
+		}
+
+		if _, err := da.value(to); err == nil {
+			ids = append(ids, to)
+			lens = append(lens, i+1)
+		}
+
+		from = to
+	}
+
+	return
+}
+
+// PrefixMatchResume is like PrefixMatch, but starts from the node `from`
+// and also returns where the walk stopped: the deepest node reached
+// and the number of bytes of the key consumed to reach it,
+// so that a streaming parser can go on from there, e.g. with Step or
+// a PrefixPredict of the remaining completions.
+// lastNode is `from` and consumed is 0, if the first byte does not match.
+func (da *Cedar) PrefixMatchResume(key []byte, from int) (ids []int,
+	lastNode int, consumed int) {
+	lastNode = from
+	for _, b := range key {
+		to, ok := da.Step(lastNode, b)
+		if !ok {
+			break
+		}
+
+		if _, err := da.value(to); err == nil {
+			ids = append(ids, to)
+		}
+
+		lastNode = to
+		consumed++
+	}
+
+	return
+}
+
+// PrefixPredict returns a list of at most `num` nodes
+// which has the key as their prefix.
+// These nodes are ordered by their keys.
+// The node of the key itself is included if the key has a value,
+// use PrefixPredictSelf to leave it out.
+// If `num` is 0, it returns all matches.
+// For example, if the following keys were inserted:
+//	id	key
+//	19	abc
+//	23	ab
+//	37	abcd
+// then
+//	PrefixPredict([]byte("ab"), 2) = [ 23, 19 ]			// predict ["ab", "abc"]
+//	PrefixPredict([]byte("ab"), 0) = [ 23, 19, 37 ]
+// predict ["ab", "abc", "abcd"]
+func (da *Cedar) PrefixPredict(key []byte, num int) (ids []int) {
+	return da.PrefixPredictSelf(key, num, true)
+}
+
+// PrefixPredictSelf is like PrefixPredict, but lets the caller decide
+// whether the node of the key itself is part of the result.
+// If `includeSelf` is false, only the keys strictly longer than
+// the key are returned, e.g. for the keys in the example of PrefixPredict
+//	PrefixPredictSelf([]byte("ab"), 0, false) = [ 19, 37 ]
+// predict ["abc", "abcd"]
+func (da *Cedar) PrefixPredictSelf(key []byte, num int, includeSelf bool) (ids []int) {
+	ck := cacheKey{string(key), num, includeSelf}
+	if ids, ok := da.cache.get(ck); ok {
+		return ids
+	}
+
+	root, err := da.Jump(key, 0)
+	if err != nil {
+		return
+	}
+
+	ids = da.predict(root, num, includeSelf)
+	da.cache.add(ck, ids)
+	return
+}
+
+// MultiPrefixPredict returns the PrefixPredict of all the prefixes,
+// so that preds[string(p)] is PrefixPredict(p, 0) for each prefix `p`,
+// e.g. to suggest the completions of several fields at once.
+// The prefixes are walked in their byte order, and each one goes on
+// from the deepest node it shares with the previous one, so the common
+// ancestry of the prefixes is only walked once.
+func (da *Cedar) MultiPrefixPredict(prefixes [][]byte) (preds map[string][]int) {
+	preds = make(map[string][]int, len(prefixes))
+	sorted := make([][]byte, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	// path[i] is the node of the first i bytes of the previous prefix.
+	path := []int{0}
+	var prev []byte
+	for _, prefix := range sorted {
+		if _, ok := preds[string(prefix)]; ok {
+			continue
+		}
+
+		n := CommonPrefixLen(prev, prefix)
+		if n >= len(path) {
+			n = len(path) - 1
+		}
+		path, prev = path[:n+1], prefix
+
+		for _, b := range prefix[n:] {
+			to, ok := da.Step(path[len(path)-1], b)
+			if !ok {
+				break
+			}
+			path = append(path, to)
+		}
+
+		var ids []int
+		if len(path) == len(prefix)+1 {
+			ids = da.predict(path[len(path)-1], 0, true)
+		}
+		preds[string(prefix)] = ids
+	}
+
+	return
+}
+
+// PredictAny returns the nodes of at most `limit` keys which have any
+// of the prefixes as their prefix, all of them if `limit` is 0.
+// These nodes are ordered by their keys, and each is returned once:
+// a prefix extending another one is dropped, as its subtree is in the
+// other's, so each subtree is walked once.
+func (da *Cedar) PredictAny(prefixes [][]byte, limit int) (ids []int) {
+	sorted := make([][]byte, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	// the extensions of a prefix follow it in the byte order
+	var last []byte
+	for i, prefix := range sorted {
+		if i > 0 && bytes.HasPrefix(prefix, last) {
+			continue
+		}
+		last = prefix
+
+		root, err := da.Jump(prefix, 0)
+		if err != nil {
+			continue
+		}
+
+		num := 0
+		if limit > 0 {
+			num = limit - len(ids)
+		}
+		ids = append(ids, da.predict(root, num, true)...)
+		if limit > 0 && len(ids) >= limit {
+			break
+		}
+	}
+
+	return
+}
+
+// Extensions returns the nodes of all keys which strictly extend
+// the prefix, starting from the node `from`.
+// The key of the prefix itself is never returned.
+// These nodes are ordered by their keys.
+func (da *Cedar) Extensions(prefix []byte, from int) []int {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return nil
+	}
+
+	return da.predict(root, 0, false)
+}
+
+// PredictFrom returns the nodes of at most `limit` keys under the node
+// `id`, e.g. reached by Step or JumpNode, without walking from the root
+// again, all of them if `limit` is 0. The value node of `id` itself
+// comes first, if it has a value. It returns nil, if `id` is not a node.
+func (da *Cedar) PredictFrom(id int, limit int) (ids []int) {
+	if !da.isNode(id) {
+		return nil
+	}
+
+	if to, ok := da.valueNode(id); ok {
+		ids = append(ids, to)
+		if limit == 1 {
+			return ids
+		}
+	}
+
+	if limit > 0 {
+		limit -= len(ids)
+	}
+
+	return append(ids, da.predict(id, limit, false)...)
+}
+
+// CompleteSuffixes returns at most `limit` completions of the prefix,
+// starting from the node `from`, as the bytes to append to the prefix,
+// ordered by their keys. If the prefix itself has a value,
+// its completion is the empty suffix. If `limit` is 0, it returns all.
+func (da *Cedar) CompleteSuffixes(prefix []byte, from, limit int) (suffixes [][]byte) {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return
+	}
+
+	da.walk(root, func(id int, suffix []byte) bool {
+		suffixes = append(suffixes, append([]byte{}, suffix...))
+		return len(suffixes) != limit
+	})
+
+	return
+}
+
+// PrefixPredictOrdered returns the nodes of all keys which have the prefix,
+// starting from the node `from`, sorted with the comparator `less`
+// on their keys instead of the byte order of the cedar.
+func (da *Cedar) PrefixPredictOrdered(prefix []byte, from int,
+	less func(aKey, bKey []byte) bool) []int {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return nil
+	}
+
+	ids := da.predict(root, 0, true)
+	keys := make([][]byte, len(ids))
+	for i, id := range ids {
+		keys[i], _ = da.Key(id)
+	}
+
+	sort.Stable(byKeys{ids, keys, less})
+	return ids
+}
+
+type byKeys struct {
+	ids  []int
+	keys [][]byte
+	less func(aKey, bKey []byte) bool
+}
+
+func (s byKeys) Len() int { return len(s.ids) }
+
+func (s byKeys) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+
+func (s byKeys) Swap(i, j int) {
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// CoveringPrefixes returns a set of prefixes, in their byte order, such
+// that each key starts with exactly one of them, e.g. to derive coarse
+// routing rules from the keys. It descends from the root, and cuts at
+// the first node of each path which is either:
+//
+//	at the depth maxLen, covering all the keys under it
+//	a key itself, covering it and all its extensions
+//	the root of a subtree of a single key, covering that key
+//
+// so that the prefixes are as short as possible while distinguishing the
+// keys up to maxLen bytes, and a prefix is a key only if a longer key
+// extends it. If maxLen is negative, the depth is unlimited.
+func (da *Cedar) CoveringPrefixes(maxLen int) (prefixes [][]byte) {
+	var (
+		key   []byte
+		visit func(from int)
+	)
+
+	visit = func(from int) {
+		_, isKey := da.valueNode(from)
+		if len(key) == maxLen || isKey || da.countAtMost(from, 2) == 1 {
+			prefixes = append(prefixes, append([]byte(nil), key...))
+			return
+		}
+
+		da.eachChild(from, func(label byte, to int) bool {
+			if label != 0 {
+				key = append(key, da.char(label))
+				visit(to)
+				key = key[:len(key)-1]
+			}
+			return true
+		})
+	}
+
+	if da.countAtMost(0, 1) > 0 {
+		visit(0)
+	}
+
+	return
+}
+
+// countAtMost counts the keys under the node `root`, up to `n`.
+func (da *Cedar) countAtMost(root, n int) (count int) {
+	da.walk(root, func(int, []byte) bool {
+		count++
+		return count < n
+	})
+
+	return
+}
+
+// SplitByCount returns at most n-1 boundary keys which split the keys
+// of the cedar, in byte order, into n ranges of roughly equal size:
+// the i-th range holds the keys from boundary i-1 (inclusive)
+// to boundary i (exclusive). It walks all the keys once.
+func (da *Cedar) SplitByCount(n int) (bounds [][]byte) {
+	ids := da.predict(0, 0, true)
+	last := 0
+	for i := 1; i < n; i++ {
+		at := i * len(ids) / n
+		if at == last {
+			continue
+		}
+
+		key, _ := da.Key(ids[at])
+		bounds = append(bounds, key)
+		last = at
+	}
+
+	return
+}
+
+// NumKeys returns the number of keys in the cedar, in O(1),
+// unlike Status which scans all the nodes.
+func (da *Cedar) NumKeys() int {
+	return da.keys
+}
+
+// TotalKeyBytes returns the sum of the lengths of all the keys,
+// e.g. to report that the cedar holds NumKeys keys of TotalKeyBytes
+// bytes, unlike the size of its arrays. It walks all the keys once.
+func (da *Cedar) TotalKeyBytes() (n int) {
+	da.walk(0, func(id int, key []byte) bool {
+		n += len(key)
+		return true
+	})
+
+	return
+}
+
+// RecountKeys counts the keys by scanning all the nodes, caches the
+// count for NumKeys, which the mutations keep up to date from then on,
+// and returns it. Load does it already, also for the cedars saved in
+// the legacy format without the header, so it is only needed after
+// the exported fields of the cedar were modified directly.
+func (da *Cedar) RecountKeys() int {
+	da.keys, _, _, _ = da.Status()
+	return da.keys
+}
+
+// PrefixCount returns the number of keys which have the prefix,
+// starting from the node `from`, including the prefix itself.
+// It walks all the nodes under the prefix.
+func (da *Cedar) PrefixCount(prefix []byte, from int) (count int) {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return 0
+	}
+
+	da.walk(root, func(int, []byte) bool {
+		count++
+		return true
+	})
+
+	return
+}
+
+// PrefixSum returns the sum of the values of the keys which have
+// the prefix, starting from the node `from`, including the prefix itself,
+// e.g. the total of the counts stored under a namespace. The keys added
+// by InsertIn are skipped. It walks all the nodes under the prefix.
+func (da *Cedar) PrefixSum(prefix []byte, from int) (sum int) {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return 0
+	}
+
+	da.walk(root, func(id int, _ []byte) bool {
+		if !da.Ninfos[id].End {
+			sum += da.decoded(da.Array[id].Value)
+		}
+		return true
+	})
+
+	return
+}
+
+// The budget of keys walked by PrefixSelectivity before it estimates,
+// and the number of random descents of the estimate.
+const (
+	selectivityWalk   = 256
+	selectivityProbes = 64
+)
+
+// PrefixSelectivity returns the fraction of the keys of the cedar
+// which have the prefix, starting from the node `from`,
+// i.e. PrefixCount / NumKeys, without walking big subtrees.
+// It is exact when at most 256 keys have the prefix. Otherwise it is
+// estimated by random descents from the prefix, each multiplying
+// the numbers of children on its way (Knuth's estimator): the estimate
+// is unbiased but noisy for unbalanced subtrees, and costs O(64 * depth)
+// steps. The descents are seeded, so the estimate is reproducible.
+func (da *Cedar) PrefixSelectivity(prefix []byte, from int) float64 {
+	if da.keys == 0 {
+		return 0
+	}
+
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	da.walk(root, func(int, []byte) bool {
+		count++
+		return count <= selectivityWalk
+	})
+
+	if count <= selectivityWalk {
+		return float64(count) / float64(da.keys)
+	}
+
+	r := rand.New(rand.NewSource(int64(root)))
+	sum := 0.0
+	for i := 0; i < selectivityProbes; i++ {
+		sum += da.descent(root, r)
+	}
+
+	sel := sum / selectivityProbes / float64(da.keys)
+	if sel > 1 {
+		sel = 1
+	}
+
+	return sel
+}
+
+// descent walks down from the node `from` to a random value,
+// and returns the product of the numbers of children on its way.
+func (da *Cedar) descent(from int, r *rand.Rand) float64 {
+	estimate := 1.0
+	var children []int
+	for da.Array[from].Value < 0 {
+		children = children[:0]
+		da.eachChild(from, func(_ byte, to int) bool {
+			children = append(children, to)
+			return true
+		})
+
+		if len(children) == 0 {
+			return 0
+		}
+
+		estimate *= float64(len(children))
+		from = children[r.Intn(len(children))]
+	}
+
+	return estimate
+}
+
+// SubtreeNodeCount returns the number of nodes, with or without a value,
+// in the subtree of the prefix starting from the node `from`,
+// the node of the prefix included. It returns 0 if the prefix is not found.
+func (da *Cedar) SubtreeNodeCount(prefix []byte, from int) (count int) {
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return
+	}
+
+	stack := []int{root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		count++
+
+		da.eachChild(id, func(label byte, to int) bool {
+			stack = append(stack, to)
+			return true
+		})
+	}
+
+	return
+}
+
+// SubTrie returns a new cedar holding the keys under the prefix,
+// starting from the node `from`, with the prefix stripped.
+// It is empty if the prefix is not found.
+func (da *Cedar) SubTrie(prefix []byte, from int) *Cedar {
+	sub := da.newLike()
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return sub
+	}
+
+	da.walk(root, func(id int, key []byte) bool {
+		da.copyValue(sub, key, id)
+		return true
+	})
+
+	return sub
+}
+
+// WithCommonPrefix returns a new cedar holding all the keys
+// with the prefix prepended, it is the inverse of SubTrie.
+func (da *Cedar) WithCommonPrefix(prefix []byte) *Cedar {
+	n := da.newLike()
+	key := append([]byte(nil), prefix...)
+	da.walk(0, func(id int, suffix []byte) bool {
+		da.copyValue(n, append(key[:len(prefix)], suffix...), id)
+		return true
+	})
+
+	return n
+}
+
+// ForEach calls fn for each key added by Insert or Update with its value,
+// in the order of the keys, until fn returns false. The keys added by
+// InsertIn are skipped. The key is only valid during the call,
+// and fn must not modify the cedar.
+func (da *Cedar) ForEach(fn func(key []byte, value int) bool) {
+	da.forEach(func(key []byte, value int) bool {
+		return fn(key, da.decoded(value))
+	})
+}
+
+// Columns returns the keys added by Insert or Update and their values
+// as two aligned slices in the order of the keys, e.g. to export them
+// to a columnar store. They are filled by a single traversal, which
+// sorts the children of each node when the cedar is not Ordered.
+func (da *Cedar) Columns() (keys [][]byte, values []int) {
+	keys = make([][]byte, 0, da.NumKeys())
+	values = make([]int, 0, da.NumKeys())
+	da.walkSorted(0, func(id int, key []byte) bool {
+		if da.Ninfos[id].End {
+			return true
+		}
+
+		keys = append(keys, append([]byte(nil), key...))
+		values = append(values, da.decoded(da.Array[id].Value))
+		return true
+	})
+
+	return
+}
+
+// ForEachMut is like ForEach, but passes a pointer to the value, so that
+// fn can change it in place, e.g. to decay all the counts in one pass.
+// The stored values are passed, without the value decoder. Only the value
+// may be changed during the iteration, fn must not modify the cedar.
+// It stops and returns ErrInvalidValue, if fn sets an invalid value,
+// which is then left unchanged.
+func (da *Cedar) ForEachMut(fn func(key []byte, value *int) bool) (err error) {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	da.cache.clear()
+	da.walk(0, func(id int, key []byte) bool {
+		if da.Ninfos[id].End {
+			return true
+		}
+
+		old := da.Array[id].Value
+		value := old
+		goOn := fn(key, &value)
+		if value == old {
+			return goOn
+		}
+
+		if value < 0 || value >= ValueLimit {
+			err = ErrInvalidValue
+			return false
+		}
+
+		da.indexRemove(key, old)
+		da.Array[id].Value = value
+		da.indexAdd(key, value)
+		da.used(value)
+		if da.onInsert != nil {
+			da.onInsert(key, value)
+		}
+		return goOn
+	})
+
+	return
+}
+
+// forEach is ForEach with the stored values.
+func (da *Cedar) forEach(fn func(key []byte, value int) bool) {
+	da.walk(0, func(id int, key []byte) bool {
+		if da.Ninfos[id].End {
+			return true
+		}
+
+		return fn(key, da.Array[id].Value)
+	})
+}
+
+// ChangedSince returns the ids of the keys which are both in the cedar
+// and in the snapshot `snap`, but with a different value, in the order
+// of the keys, e.g. to push only the changes to another system.
+// The values added by InsertIn are compared with reflect.DeepEqual,
+// and a key whose value was added by Insert in one and by InsertIn
+// in the other has changed. The keys added or deleted since the
+// snapshot are not reported. It walks both tries together, following
+// the paths of the cedar in the snapshot, in O(size of the cedar).
+func (da *Cedar) ChangedSince(snap *Cedar) (ids []int) {
+	var visit func(from, sfrom int)
+	visit = func(from, sfrom int) {
+		if id, ok := da.valueNode(from); ok {
+			if sid, ok := snap.valueNode(sfrom); ok && !da.sameValue(id, snap, sid) {
+				ids = append(ids, from)
+			}
+		}
+
+		da.eachChild(from, func(label byte, to int) bool {
+			if label == 0 {
+				return true
+			}
+
+			if sto, ok := snap.Step(sfrom, da.char(label)); ok {
+				visit(to, sto)
+			}
+			return true
+		})
+	}
+
+	visit(0, 0)
+	return
+}
+
+// KeyChange is a key whose value changed, reported by Diff.
+type KeyChange struct {
+	Key      []byte
+	OldValue int
+	NewValue int
+}
+
+// Diff compares the cedar with an older version `old` of it, and
+// returns the keys added to it, the keys removed from it and the keys
+// whose value changed, each in byte order. Only the keys added by Insert
+// or Update are compared, like ForEach, the keys added by InsertIn
+// are ignored. It walks both tries together, in O(size of both).
+func (da *Cedar) Diff(old *Cedar) (added, removed [][]byte, changed []KeyChange) {
+	var (
+		key   []byte
+		visit func(from, ofrom int)
+	)
+
+	visit = func(from, ofrom int) {
+		value, ok := da.intValue(from)
+		oldValue, oldOk := old.intValue(ofrom)
+		switch {
+		case ok && !oldOk:
+			added = append(added, append([]byte(nil), key...))
+		case !ok && oldOk:
+			removed = append(removed, append([]byte(nil), key...))
+		case ok && value != oldValue:
+			changed = append(changed, KeyChange{
+				Key:      append([]byte(nil), key...),
+				OldValue: oldValue,
+				NewValue: value,
+			})
+		}
+
+		var labels []int
+		var seen [256]bool
+		for _, n := range []struct {
+			da   *Cedar
+			from int
+		}{{da, from}, {old, ofrom}} {
+			if n.from < 0 {
+				continue
+			}
+
+			n.da.eachChild(n.from, func(label byte, _ int) bool {
+				if label == 0 {
+					return true
+				}
+
+				if c := n.da.char(label); !seen[c] {
+					seen[c] = true
+					labels = append(labels, int(c))
+				}
+				return true
+			})
+		}
+		sort.Ints(labels)
+
+		for _, label := range labels {
+			to, oto := -1, -1
+			if from >= 0 {
+				if id, ok := da.Step(from, byte(label)); ok {
+					to = id
+				}
+			}
+
+			if ofrom >= 0 {
+				if id, ok := old.Step(ofrom, byte(label)); ok {
+					oto = id
+				}
+			}
+
+			key = append(key, byte(label))
+			visit(to, oto)
+			key = key[:len(key)-1]
+		}
+	}
+
+	visit(0, 0)
+	return
+}
+
+// intValue returns the value added by Insert or Update
+// of the key of the node `id`, if any, where -1 is no node.
+func (da *Cedar) intValue(id int) (int, bool) {
+	if id < 0 {
+		return 0, false
+	}
+
+	to, ok := da.valueNode(id)
+	if !ok || da.Ninfos[to].End {
+		return 0, false
+	}
+
+	return da.Array[to].Value, true
+}
+
+// sameValue reports whether the value node `id` holds the same value
+// as the node `sid` of `other`.
+func (da *Cedar) sameValue(id int, other *Cedar, sid int) bool {
+	if da.Ninfos[id].End != other.Ninfos[sid].End {
+		return false
+	}
+
+	if !da.Ninfos[id].End {
+		return da.Array[id].Value == other.Array[sid].Value
+	}
+
+	return reflect.DeepEqual(da.vals[da.Array[id].Value].Value,
+		other.vals[other.Array[sid].Value].Value)
+}
+
+// KeysAfter returns at most `limit` keys strictly greater than `after`,
+// in ascending order, for a paginated enumeration restarting from
+// the last key of the previous page. It descends along `after`,
+// skipping the smaller subtrees, instead of walking from the first key.
+// If `limit` is 0, it returns all of them. The children of a node are
+// sorted on the way when the cedar is not Ordered.
+func (da *Cedar) KeysAfter(after []byte, limit int) (keys [][]byte) {
+	var (
+		key   []byte
+		visit func(from int, bound bool) bool
+	)
+
+	emit := func() bool {
+		keys = append(keys, append([]byte(nil), key...))
+		return len(keys) != limit
+	}
+
+	// bound is true while the key equals the prefix of `after`,
+	// its own value is not greater then
+	visit = func(from int, bound bool) bool {
+		if da.Array[from].Value >= 0 {
+			return bound || emit()
+		}
+
+		depth := len(key)
+		return da.eachChildSorted(from, func(label byte, to int) bool {
+			if label == 0 {
+				if bound || da.Array[to].Value < 0 {
+					return true
+				}
+				return emit()
+			}
+
+			c := da.char(label)
+			childBound := false
+			if bound && depth < len(after) {
+				if c < after[depth] {
+					return true
+				}
+				childBound = c == after[depth]
+			}
+
+			key = append(key, c)
+			ok := visit(to, childBound)
+			key = key[:len(key)-1]
+			return ok
+		})
+	}
+
+	visit(0, true)
+	return
+}
+
+// Sample returns the ids of at most `n` keys chosen uniformly at random,
+// by reservoir sampling in a single walk, without collecting all the keys.
+// The same seed gives the same sample of the same cedar.
+// It returns all the keys, in order, if there are less than `n`.
+func (da *Cedar) Sample(n int, seed int64) (ids []int) {
+	if n <= 0 {
+		return
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	seen := 0
+	da.walk(0, func(id int, _ []byte) bool {
+		seen++
+		if len(ids) < n {
+			ids = append(ids, id)
+		} else if i := r.Intn(seen); i < n {
+			ids[i] = id
+		}
+		return true
+	})
+
+	return
+}
+
+// DetachPrefix removes the keys which have the prefix, starting from
+// the node `from`, including the prefix itself, and returns them in a new
+// cedar with the same settings, e.g. to move a namespace elsewhere,
+// along with their number. The keys of the new cedar are relative to
+// the prefix if `relative`, the prefix itself being the empty key,
+// or the whole keys otherwise. If no key has the prefix, the new cedar
+// is empty. It will return ErrReadOnly, if the cedar is read-only.
+func (da *Cedar) DetachPrefix(prefix []byte, from int,
+	relative bool) (detached *Cedar, n int, err error) {
+	if err := da.writable(); err != nil {
+		return nil, 0, err
+	}
+
+	detached = da.newLike()
+	root, err := da.Jump(prefix, from)
+	if err != nil {
+		return detached, 0, nil
+	}
+
+	var whole []byte
+	if root != 0 {
+		whole, _ = da.Key(root)
+	}
+
+	var keys [][]byte
+	da.walk(root, func(id int, key []byte) bool {
+		abs := append(whole[:len(whole):len(whole)], key...)
+		if relative {
+			err = da.copyValue(detached, key, id)
+		} else {
+			err = da.copyValue(detached, abs, id)
+		}
+
+		keys = append(keys, abs)
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, key := range keys {
+		if err := da.Delete(key); err != nil {
+			return detached, n, err
+		}
+		n++
+	}
+
+	return detached, n, nil
+}
+
+// DeleteByValue removes all the keys added by Insert or Update
+// with the value, and returns how many were removed.
+// Without WithValueIndex, it walks the whole cedar, so it costs
+// O(nodes) for each call, plus the deletions.
+func (da *Cedar) DeleteByValue(value int) (n int, err error) {
+	if err := da.writable(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range da.KeysForValue(value) {
+		if err := da.Delete(key); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// Keep removes all the keys but the `topN` keys with the highest values,
+// e.g. to bound a frequency dictionary to its most frequent words,
+// and returns how many were removed. Of the keys tied at the lowest
+// value kept, the first ones in the byte order are kept. The keys added
+// by InsertIn have no rank, so they come after all the others: they are
+// kept, the first ones in the byte order, only while there are less than
+// `topN` other keys. The threshold is found by a partial selection over
+// the values, not a full sort.
+func (da *Cedar) Keep(topN int) (n int, err error) {
+	if err := da.writable(); err != nil {
+		return 0, err
+	}
+
+	var values []int
+	da.forEach(func(key []byte, value int) bool {
+		values = append(values, value)
+		return true
+	})
+
+	keep, threshold, extra := 0, 0, 0
+	if topN > len(values) {
+		extra = topN - len(values)
+		topN = len(values)
+	}
+	if topN > 0 {
+		threshold = selectLargest(values, topN-1)
+		for _, v := range values {
+			if v > threshold {
+				keep++
+			}
+		}
+	}
+
+	// keep the ties at the threshold up to topN, and then the keys
+	// added by InsertIn up to `extra`, in the byte order.
+	ties := topN - keep
+	var keys [][]byte
+	da.walkSorted(0, func(id int, key []byte) bool {
+		v, ok := da.intValue(id)
+		switch {
+		case ok && topN > 0 && v > threshold:
+		case ok && topN > 0 && v == threshold && ties > 0:
+			ties--
+		case !ok && extra > 0:
+			extra--
+		default:
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		return true
+	})
+
+	for _, key := range keys {
+		if err := da.Delete(key); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// selectLargest returns the k-th largest of the values, counting from 0,
+// by a quickselect which reorders the values in place.
+func selectLargest(values []int, k int) int {
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		pivot := values[(lo+hi)/2]
+		i, j := lo, hi
+		for i <= j {
+			for values[i] > pivot {
+				i++
+			}
+			for values[j] < pivot {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return values[k]
+		}
+	}
+
+	return values[k]
+}
+
+// Rebuild returns a new cedar holding all the keys, inserted in order
+// with the given MaxTrial, which packs the nodes more densely than
+// the cedar built with the default MaxTrial of 1, or after deletions.
+// The cedar itself is left untouched. The new cedar has the settings
+// of the cedar, but the limits of WithMaxNodes, NewFixed and
+// WithMaxKeyLen only apply to the insertions after the rebuild, so that
+// it holds every key even if it needs more nodes, see Compact.
+func (da *Cedar) Rebuild(maxTrial int) *Cedar {
+	n := da.newLike()
+	maxCapacity, maxKeyLen := n.maxCapacity, n.maxKeyLen
+	n.maxCapacity, n.maxKeyLen = 0, 0
+	// nothing else fails the insertion of the keys of a cedar
+	da.rebuild(n, maxTrial)
+	n.maxCapacity, n.maxKeyLen = maxCapacity, maxKeyLen
+
+	return n
+}
+
+// rebuild inserts all the keys into the empty cedar `n` in order,
+// with the given MaxTrial, and stops at the first error.
+func (da *Cedar) rebuild(n *Cedar, maxTrial int) (err error) {
+	n.MaxTrial = maxTrial
+	da.walk(0, func(id int, key []byte) bool {
+		err = da.copyValue(n, key, id)
+		return err == nil
+	})
+
+	return
+}
+
+// Compact rebuilds the cedar in place, like Rebuild with its MaxTrial,
+// so that its nodes are densely packed after deletions or insertions
+// in an arbitrary order. The node ids change, while the keys, values
+// and settings are kept. It costs a walk and an insertion of every key.
+// If the rebuilt cedar does not fit, e.g. it returns ErrCapacityExceeded
+// for the limit of WithMaxNodes or NewFixed, the cedar is left untouched.
+func (da *Cedar) Compact() error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	n := da.newLike()
+	if err := da.rebuild(n, da.MaxTrial); err != nil {
+		return err
+	}
+
+	da.setStorage(n)
+	da.cache.clear()
+	return nil
+}
+
+// CompactVals renumbers the values added by InsertIn densely from 1,
+// and drops the values which are no longer held by any key, e.g. left
+// by an older version after deletions, so that finding a free number
+// for the next InsertIn stays fast. The node ids and the values are kept.
+func (da *Cedar) CompactVals() error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	vals := make(map[int]nvalue)
+	for i := 0; i < da.Size; i++ {
+		n := &da.Array[i]
+		if n.Check < 0 || n.Value < 0 || !da.Ninfos[i].End {
+			continue
+		}
+
+		k := len(vals) + 1
+		vals[k] = da.vals[n.Value]
+		n.Value = k
+	}
+
+	da.vals, da.vkey, da.vfree = vals, len(vals), 0
+	da.cache.clear()
+	return nil
+}
+
+// WithCompactOnLoad makes the cedar Compact itself after each Load,
+// LoadWithCodec or InsertChan, which import many keys at once,
+// so that it is densely packed for the following lookups. A cedar
+// which does not fit the limit of WithMaxNodes or NewFixed once
+// compacted is kept as it was loaded.
+func WithCompactOnLoad() Option {
+	return func(da *Cedar) {
+		da.compactOnLoad = true
+	}
+}
+
+// loaded compacts the cedar after a load, if asked to.
+func (da *Cedar) loaded() error {
+	if !da.compactOnLoad {
+		return nil
+	}
+
+	if err := da.Compact(); err != ErrCapacityExceeded {
+		return err
+	}
+
+	return nil
+}
+
+// Intersects reports whether the two cedars share at least one key,
+// with either kind of value. It walks the smaller cedar and stops
+// at the first key found in the other, like Contains, so the lookups
+// do not count as accesses to the keys.
+func (da *Cedar) Intersects(other *Cedar) bool {
+	small, large := da, other
+	if other.NumKeys() < da.NumKeys() {
+		small, large = other, da
+	}
+
+	found := false
+	small.walk(0, func(id int, key []byte) bool {
+		found = large.Contains(key)
+		return !found
+	})
+
+	return found
+}
+
+// newLike returns an empty cedar with the same settings.
+func (da *Cedar) newLike() *Cedar {
+	n := New()
+	n.Ordered = da.Ordered
+	n.MaxTrial = da.MaxTrial
+	n.term = da.term
+	if da.index != nil {
+		WithValueIndex()(n)
+	}
+
+	if da.alloc != nil {
+		WithAllocator(da.alloc)(n)
+	}
+	n.valueDecoder, n.maxKeyLen = da.valueDecoder, da.maxKeyLen
+	n.maxCapacity, n.fixed = da.maxCapacity, da.fixed
+	if n.fixed {
+		n.grow(n.maxCapacity)
+	}
+	n.deterministic = da.deterministic
+
+	return n
+}
+
+// copyValue inserts the value of the node `id` into `dst` as the key.
+func (da *Cedar) copyValue(dst *Cedar, key []byte, id int) error {
+	value := da.Array[id].Value
+	if da.Ninfos[id].End {
+		v := da.vals[value]
+		return dst.InsertInLen(key, v.Value, v.Len)
+	}
+
+	return dst.Insert(key, value)
+}
+
+// walk calls fn for each node with a value under the node `root`,
+// in the order of the keys, until fn returns false.
+// The key passed to fn is relative to `root`, and is only valid
+// during the call.
+func (da *Cedar) walk(root int, fn func(id int, key []byte) bool) {
+	da.walkWith(root, da.eachChild, fn)
+}
+
+// walkSorted is like walk, but also in the order of the keys
+// when the cedar is not Ordered.
+func (da *Cedar) walkSorted(root int, fn func(id int, key []byte) bool) {
+	da.walkWith(root, da.eachChildSorted, fn)
+}
+
+// walkWith is walk with the children visited by `each`.
+func (da *Cedar) walkWith(root int, each func(int, func(byte, int) bool) bool,
+	fn func(id int, key []byte) bool) {
+	var (
+		key   []byte
+		visit func(from int) bool
+	)
+
+	visit = func(from int) bool {
+		if da.Array[from].Value >= 0 {
+			return fn(from, key)
+		}
+
+		return each(from, func(label byte, to int) bool {
+			if label == 0 {
+				if da.Array[to].Value >= 0 {
+					return fn(to, key)
+				}
+				return true
+			}
+
+			key = append(key, da.char(label))
+			ok := visit(to)
+			key = key[:len(key)-1]
+			return ok
+		})
+	}
+
+	visit(root)
+}
+
+// predict collects at most `num` nodes under the node `root`.
+func (da *Cedar) predict(root, num int, includeSelf bool) (ids []int) {
+	self := -1
+	if !includeSelf {
+		if id, ok := da.valueNode(root); ok {
+			self = id
+		}
+	}
+
+	for from, err := da.begin(root); err == nil; from, err = da.next(from, root) {
+		if from == self {
+			continue
+		}
+
+		ids = append(ids, from)
+		num--
+		if num == 0 {
+			return
+		}
+	}
+
+	return
+}
+
+func (da *Cedar) begin(from int) (to int, err error) {
+	for c := da.Ninfos[from].Child; c != 0; {
+		to = da.Array[from].base() ^ int(c)
+		c = da.Ninfos[to].Child
+		from = to
+	}
+
+	if base := da.Array[from].base(); base > 0 {
+		// a node without any child, i.e. the root of an empty cedar.
+		if da.Array[base].Check != from {
+			return 0, ErrNoPath
+		}
+		return base, nil
+	}
+
+	return from, nil
+}
+
+func (da *Cedar) next(from int, root int) (to int, err error) {
+	c := da.Ninfos[from].Sibling
+	for c == 0 && from != root && da.Array[from].Check >= 0 {
+		from = da.Array[from].Check
+		c = da.Ninfos[from].Sibling
+	}
+
+	if from == root {
+		return 0, ErrNoPath
+	}
+	from = da.Array[da.Array[from].Check].base() ^ int(c)
+
+	return da.begin(from)
+}
+
+// eachChild calls fn for each child of the node `from`, in sibling order,
+// until fn returns false. The terminal child has the label 0.
+func (da *Cedar) eachChild(from int, fn func(label byte, to int) bool) bool {
+	if da.Array[from].Value >= 0 {
+		return true
+	}
+
+	base := da.Array[from].base()
+	c := da.Ninfos[from].Child
+	if da.Array[base^int(c)].Check != from {
+		return true
+	}
+
+	for {
+		to := base ^ int(c)
+		sibling := da.Ninfos[to].Sibling
+		if !fn(c, to) {
+			return false
+		}
+
+		if sibling == 0 {
+			return true
+		}
+		c = sibling
+	}
+}
+
+// eachChildSorted is like eachChild, but in the order of the labels,
+// i.e. of the keys, also when the cedar is not Ordered.
+func (da *Cedar) eachChildSorted(from int, fn func(label byte, to int) bool) bool {
+	if da.Ordered {
+		return da.eachChild(from, fn)
+	}
+
+	var labels []int
+	da.eachChild(from, func(label byte, _ int) bool {
+		labels = append(labels, int(label))
+		return true
+	})
+	sort.Ints(labels)
+
+	base := da.Array[from].base()
+	for _, label := range labels {
+		if !fn(byte(label), base^label) {
+			return false
+		}
+	}
+
+	return true
 }
@@ -0,0 +1,284 @@
+package cedar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// binaryFormat follows the header of the cedars written by WriteTo,
+// unlike the gob and json streams of Save.
+const binaryFormat = 'b'
+
+// binaryWriter writes varints through a small buffer,
+// keeping the first error and the number of bytes written.
+type binaryWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	n   int64
+	err error
+}
+
+func (bw *binaryWriter) write(p []byte) {
+	if bw.err != nil {
+		return
+	}
+
+	n, err := bw.w.Write(p)
+	bw.n += int64(n)
+	bw.err = err
+}
+
+func (bw *binaryWriter) int(v int) {
+	n := binary.PutVarint(bw.buf[:], int64(v))
+	bw.write(bw.buf[:n])
+}
+
+// WriteTo writes the cedar to `w` in a binary format, block by block
+// through a small buffer, so that it needs no memory for the encoded
+// cedar, unlike Save. Read it back with ReadFrom. Like SaveWithCodec,
+// it writes the values added by InsertIn after the blocks, encoded with
+// GobCodec, so their concrete types must be registered with gob.Register.
+// It implements io.WriterTo.
+func (da *Cedar) WriteTo(w io.Writer) (int64, error) {
+	bw := &binaryWriter{w: bufio.NewWriterSize(w, 4096)}
+	bw.write(append(magic[:len(magic):len(magic)], formatVersion, binaryFormat))
+
+	ordered := 0
+	if da.Ordered {
+		ordered = 1
+	}
+
+	for _, v := range []int{da.Size, ordered, da.MaxTrial,
+		da.BheadF, da.BheadC, da.BheadO} {
+		bw.int(v)
+	}
+
+	for _, v := range da.Reject {
+		bw.int(v)
+	}
+
+	for bi := 0; bi < da.Size>>8 && bw.err == nil; bi++ {
+		for i := bi << 8; i < (bi+1)<<8; i++ {
+			bw.int(da.Array[i].Value)
+			bw.int(da.Array[i].Check)
+		}
+
+		for i := bi << 8; i < (bi+1)<<8; i++ {
+			n := da.Ninfos[i]
+			end := byte(0)
+			if n.End {
+				end = 1
+			}
+			bw.write([]byte{n.Sibling, n.Child, end})
+		}
+
+		b := da.Blocks[bi]
+		for _, v := range []int{b.Prev, b.Next, b.Num, b.Reject, b.Trial, b.Ehead} {
+			bw.int(v)
+		}
+	}
+
+	keys := make([]int, 0, len(da.vals))
+	for k := range da.vals {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	bw.int(len(keys))
+	for _, k := range keys {
+		v := da.vals[k]
+		data, err := GobCodec{}.Encode(v.Value)
+		if err != nil && bw.err == nil {
+			bw.err = err
+		}
+		bw.int(k)
+		bw.int(v.Len)
+		bw.int(len(data))
+		bw.write(data)
+	}
+
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+
+	return bw.n, bw.err
+}
+
+// countReader counts the bytes read from a reader.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// ReadFrom reads a cedar written by WriteTo from `r`, replacing the keys
+// of the cedar, like Load. It implements io.ReaderFrom.
+// It will return ErrInvalidDataType, if the stream is not in the binary
+// format or ends before its blocks and values, ErrUnsupportedVersion,
+// if it is in a newer version, and an error wrapping ErrCorrupt, if
+// the trie read is inconsistent. The cedar is left untouched on error.
+func (da *Cedar) ReadFrom(r io.Reader) (int64, error) {
+	if err := da.writable(); err != nil {
+		return 0, err
+	}
+
+	cr := &countReader{r: r}
+	n, err := readBinary(cr)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return cr.n, err
+	}
+
+	return cr.n, da.loadFrom(n)
+}
+
+// readBinary reads a cedar written by WriteTo. The arrays grow block
+// by block and the values are read through a buffer as the stream goes,
+// so the sizes it declares can not allocate more than the stream holds.
+func readBinary(r io.Reader) (n *Cedar, err error) {
+	in, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	br := in.(*bufio.Reader)
+	if format, err := br.ReadByte(); err != nil || format != binaryFormat {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidDataType
+	}
+
+	next := func() (int, error) {
+		v, err := binary.ReadVarint(br)
+		if err == nil && int64(int(v)) != v {
+			err = ErrInvalidDataType
+		}
+		return int(v), err
+	}
+
+	var ints [6]int
+	for i := range ints {
+		if ints[i], err = next(); err != nil {
+			return nil, err
+		}
+	}
+
+	size := ints[0]
+	if size <= 0 || size%256 != 0 {
+		return nil, ErrInvalidDataType
+	}
+
+	n = New()
+	n.Ordered, n.MaxTrial = ints[1] != 0, ints[2]
+	n.BheadF, n.BheadC, n.BheadO = ints[3], ints[4], ints[5]
+
+	for i := range n.Reject {
+		if n.Reject[i], err = next(); err != nil {
+			return nil, err
+		}
+	}
+
+	// short is the error of a stream which ends before its sizes
+	short := func(err error) error {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrInvalidDataType
+		}
+		return err
+	}
+
+	var info [3]byte
+	for bi := 0; bi < size>>8; bi++ {
+		if bi<<8 == n.Capacity {
+			capacity := n.Capacity * 2
+			if capacity > size {
+				capacity = size
+			}
+			n.grow(capacity)
+		}
+
+		for i := bi << 8; i < (bi+1)<<8; i++ {
+			if n.Array[i].Value, err = next(); err != nil {
+				return nil, short(err)
+			}
+			if n.Array[i].Check, err = next(); err != nil {
+				return nil, short(err)
+			}
+		}
+
+		for i := bi << 8; i < (bi+1)<<8; i++ {
+			if _, err := io.ReadFull(br, info[:]); err != nil {
+				return nil, short(err)
+			}
+			n.Ninfos[i] = ninfo{Sibling: info[0], Child: info[1], End: info[2] != 0}
+		}
+
+		b := &n.Blocks[bi]
+		for _, v := range []*int{&b.Prev, &b.Next, &b.Num, &b.Reject, &b.Trial, &b.Ehead} {
+			if *v, err = next(); err != nil {
+				return nil, short(err)
+			}
+		}
+	}
+	n.Size = size
+
+	// the values follow the blocks, but not in the streams written
+	// before WriteTo wrote them
+	count, err := next()
+	if err != nil && err != io.EOF {
+		return nil, short(err)
+	}
+
+	if count < 0 {
+		return nil, ErrInvalidDataType
+	}
+
+	var data bytes.Buffer
+	for i := 0; i < count; i++ {
+		var k, length, size int
+		for _, v := range []*int{&k, &length, &size} {
+			if *v, err = next(); err != nil {
+				return nil, short(err)
+			}
+		}
+
+		if size < 0 {
+			return nil, ErrInvalidDataType
+		}
+
+		data.Reset()
+		if _, err := io.CopyN(&data, br, int64(size)); err != nil {
+			return nil, short(err)
+		}
+
+		value, err := GobCodec{}.Decode(data.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		n.vals[k] = nvalue{Len: length, Value: value}
+	}
+	n.reserveVals()
+
+	defer func() {
+		// the structure is out of range of the arrays
+		if r := recover(); r != nil {
+			n, err = nil, ErrCorrupt
+		}
+	}()
+
+	if err := n.checkInvariants(); err != nil {
+		return nil, corrupt(err)
+	}
+
+	return n, nil
+}
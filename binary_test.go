@@ -0,0 +1,137 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := cd.WriteTo(&buf)
+	tt.Nil(t, err)
+	tt.Equal(t, int64(buf.Len()), n)
+	b := buf.Bytes()
+
+	c := New()
+	m, err := c.ReadFrom(iotest.OneByteReader(bytes.NewReader(b)))
+	tt.Nil(t, err)
+	tt.Equal(t, n, m)
+	checkConsistency(c)
+	tt.Equal(t, cd.NumKeys(), c.NumKeys())
+	tt.Equal(t, cd.Array[:cd.Size], c.Array[:c.Size])
+	tt.Nil(t, c.checkInvariants())
+
+	// it goes on growing after a read
+	tt.Nil(t, c.Insert([]byte("after read"), 1))
+	tt.Nil(t, c.checkInvariants())
+
+	_, err = New().ReadFrom(bytes.NewReader(b[:len(b)/2]))
+	tt.Equal(t, ErrInvalidDataType, err)
+	_, err = New().ReadFrom(bytes.NewReader(b[:len(magic)+3]))
+	tt.Equal(t, io.ErrUnexpectedEOF, err)
+
+	gob, err := cd.Bytes("gob")
+	tt.Nil(t, err)
+	_, err = New().ReadFrom(bytes.NewReader(gob))
+	tt.Equal(t, ErrInvalidDataType, err)
+
+	b[len(magic)] = formatVersion + 1
+	_, err = New().ReadFrom(bytes.NewReader(b))
+	_, ok := err.(ErrUnsupportedVersion)
+	tt.True(t, ok)
+}
+
+func TestWriteToValues(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.InsertIn([]byte("b"), "payload"))
+	tt.Nil(t, c.InsertInLen([]byte("d"), 42, 7))
+
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	tt.Nil(t, err)
+
+	da := New()
+	_, err = da.ReadFrom(&buf)
+	tt.Nil(t, err)
+	tt.Nil(t, da.Validate())
+	tt.Nil(t, da.InsertIn([]byte("c"), "x"))
+	tt.Nil(t, da.Validate())
+
+	for key, want := range map[string]interface{}{"b": "payload", "c": "x", "d": 42} {
+		id, err := da.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		v, err := da.ValueIn(id)
+		tt.Nil(t, err)
+		tt.Equal(t, want, v)
+	}
+
+	id, err := da.Jump([]byte("d"), 0)
+	tt.Nil(t, err)
+	length, err := da.ValueLen(id)
+	tt.Nil(t, err)
+	tt.Equal(t, 7, length)
+
+	// a stream written before the values were, which ends with the blocks
+	old := *c
+	old.vals = make(map[int]nvalue)
+	buf.Reset()
+	_, err = old.WriteTo(&buf)
+	tt.Nil(t, err)
+
+	da = New()
+	_, err = da.ReadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	tt.Nil(t, err)
+	tt.Nil(t, da.Validate())
+	tt.Nil(t, da.InsertIn([]byte("c"), "x"))
+	id, err = da.Jump([]byte("b"), 0)
+	tt.Nil(t, err)
+	v, err := da.ValueIn(id)
+	tt.Nil(t, err)
+	tt.Nil(t, v)
+}
+
+func TestReadFromInvalid(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.InsertIn([]byte("b"), "payload"))
+
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	tt.Nil(t, err)
+	b := buf.Bytes()
+
+	read := func(b []byte) error {
+		da := New()
+		tt.Nil(t, da.Insert([]byte("kept"), 1))
+		_, err := da.ReadFrom(bytes.NewReader(b))
+		tt.True(t, da.Contains([]byte("kept")))
+		return err
+	}
+
+	// a size far beyond the stream
+	head := len(magic) + 2
+	huge := append([]byte(nil), b[:head]...)
+	var varint [binary.MaxVarintLen64]byte
+	huge = append(huge, varint[:binary.PutVarint(varint[:], 1<<50)]...)
+	huge = append(huge, b[head+2:]...)
+	tt.Equal(t, ErrInvalidDataType, read(huge))
+
+	// a length of the value beyond the stream
+	tt.Equal(t, ErrInvalidDataType, read(b[:len(b)-1]))
+
+	// a free node with a parent which has no children
+	da := New()
+	tt.Nil(t, da.Insert([]byte("a"), 1))
+	da.Array[da.Array[0].base()^'b'].Check = 5
+	buf.Reset()
+	_, err = da.WriteTo(&buf)
+	tt.Nil(t, err)
+	tt.True(t, errors.Is(read(buf.Bytes()), ErrCorrupt))
+}
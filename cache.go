@@ -0,0 +1,80 @@
+package cedar
+
+import "container/list"
+
+// prefixCache is a LRU cache of the PrefixPredict results.
+type prefixCache struct {
+	size  int
+	ll    *list.List
+	items map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	prefix      string
+	num         int
+	includeSelf bool
+}
+
+type cacheEntry struct {
+	key cacheKey
+	ids []int
+}
+
+// EnablePrefixCache caches the results of the last `size` distinct
+// PrefixPredict queries. The cache is cleared by every mutation,
+// so it only pays off for read-mostly workloads with hot prefixes.
+// If `size` is 0, the cache is disabled.
+func (da *Cedar) EnablePrefixCache(size int) {
+	if size <= 0 {
+		da.cache = nil
+		return
+	}
+
+	da.cache = &prefixCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *prefixCache) get(key cacheKey) ([]int, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+
+	return append([]int(nil), e.Value.(*cacheEntry).ids...), true
+}
+
+func (c *prefixCache) add(key cacheKey, ids []int) {
+	if c == nil {
+		return
+	}
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*cacheEntry).ids = append([]int(nil), ids...)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, append([]int(nil), ids...)})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *prefixCache) clear() {
+	if c == nil || c.ll.Len() == 0 {
+		return
+	}
+
+	c.ll.Init()
+	c.items = make(map[cacheKey]*list.Element)
+}
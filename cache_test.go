@@ -0,0 +1,51 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestPrefixCache(t *testing.T) {
+	c := New()
+	c.EnablePrefixCache(1)
+
+	err := c.Insert([]byte("ab"), 1)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("abc"), 2)
+	tt.Nil(t, err)
+
+	ids := c.PrefixPredict([]byte("ab"), 0)
+	check(c, ids, []string{"ab", "abc"}, []int{1, 2})
+	tt.Equal(t, 1, c.cache.ll.Len())
+
+	// the cached result must not be shared with the caller
+	ids[0] = -1
+	ids = c.PrefixPredict([]byte("ab"), 0)
+	check(c, ids, []string{"ab", "abc"}, []int{1, 2})
+
+	ids = c.PrefixPredict([]byte("abc"), 0)
+	check(c, ids, []string{"abc"}, []int{2})
+	tt.Equal(t, 1, c.cache.ll.Len())
+
+	err = c.Insert([]byte("abcd"), 3)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, c.cache.ll.Len())
+	ids = c.PrefixPredict([]byte("abc"), 0)
+	check(c, ids, []string{"abc", "abcd"}, []int{2, 3})
+
+	err = c.Update([]byte("abcd"), 1)
+	tt.Nil(t, err)
+	ids = c.PrefixPredict([]byte("abc"), 0)
+	check(c, ids, []string{"abc", "abcd"}, []int{2, 4})
+
+	err = c.Delete([]byte("abc"))
+	tt.Nil(t, err)
+	ids = c.PrefixPredict([]byte("abc"), 0)
+	check(c, ids, []string{"abcd"}, []int{4})
+
+	c.EnablePrefixCache(0)
+	tt.Nil(t, c.cache)
+	ids = c.PrefixPredict([]byte("abc"), 0)
+	check(c, ids, []string{"abcd"}, []int{4})
+}
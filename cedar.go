@@ -52,8 +52,40 @@ type Cedar struct {
 	Blocks []block
 	Reject [257]int
 
-	vals map[int]nvalue
-	vkey int
+	vals  map[int]nvalue
+	vkey  int
+	vfree int // the lowest key of vals which may be free, see WithDeterministic
+
+	deterministic bool
+
+	cache    *prefixCache
+	readOnly bool
+
+	lastKey []byte // the key of the previous InsertSorted
+	sorted  bool   // whether lastKey is set
+
+	maxCapacity int  // the maximum number of nodes, 0 means unbounded
+	fixed       bool // whether maxCapacity nodes are allocated at once, see NewFixed
+	maxKeyLen   int // the maximum length of the keys, 0 means unlimited
+	term        byte // the byte which ends the keys, see WithTerminator
+
+	onInsert func(key []byte, value int)
+	onDelete func(key []byte)
+	onGrow   func(oldCap, newCap int)
+
+	alloc        Allocator           // the allocator of the arrays, nil is make
+	valueDecoder func(value int) int // see WithValueDecoder
+
+	display map[string][]byte // the original forms of the keys, see InsertWith
+
+	index         map[int]map[string]struct{} // the keys of each value, see WithValueIndex
+	recency       *recency
+	insertOrder   *keyList
+	compactOnLoad bool
+	keys          int // the number of keys
+	nextValue     int // the value assigned next by AutoValue
+	resolves      int // the number of conflicts resolved, see ResolveStats
+	blocks        int // the number of blocks added, see ResolveStats
 
 	BheadF int // the index of the first 'Full' block, 0 means no 'Full' block
 	BheadC int // the index of the first 'Closed' block, 0 means no ' Closed' block
@@ -65,8 +97,11 @@ type Cedar struct {
 	MaxTrial int // the parameter for cedar, it could be tuned for more, but the default is 1.
 }
 
+// Option configures a Cedar made by New.
+type Option func(*Cedar)
+
 // New new Cedar
-func New() *Cedar {
+func New(opts ...Option) *Cedar {
 	da := Cedar{
 		Array:    make([]node, 256),
 		Ninfos:   make([]ninfo, 256),
@@ -95,35 +130,183 @@ func New() *Cedar {
 		da.Reject[i] = i + 1
 	}
 
+	for _, opt := range opts {
+		opt(&da)
+	}
+
 	return &da
 }
 
+// NewFixed new Cedar which never grows beyond `capacity` nodes,
+// rounded up to a multiple of 256. The nodes are allocated at once,
+// and an insertion which needs more nodes returns ErrCapacityExceeded.
+// The arrays keep their capacity through Clear, Compact and the loads,
+// so the cedar never reallocates them while inserting.
+func NewFixed(capacity int, opts ...Option) *Cedar {
+	capacity = (capacity + 255) &^ 255
+	if capacity < 256 {
+		capacity = 256
+	}
+
+	da := New(opts...)
+	da.grow(capacity)
+	da.maxCapacity, da.fixed = capacity, true
+
+	return da
+}
+
+// WithMaxNodes limits the cedar to `n` nodes, rounded up to a multiple
+// of 256, like NewFixed but without allocating them at once: the arrays
+// grow as usual up to the limit, and an insertion which needs more
+// nodes returns ErrCapacityExceeded instead of allocating them.
+// The cedar is unbounded by default, and if n <= 0.
+func WithMaxNodes(n int) Option {
+	return func(da *Cedar) {
+		if n <= 0 {
+			da.maxCapacity = 0
+			return
+		}
+
+		n = (n + 255) &^ 255
+		if n < da.Capacity {
+			n = da.Capacity
+		}
+		da.maxCapacity = n
+	}
+}
+
+// WithDeterministic makes the nodes and the values of the cedar depend
+// only on its keys and the order of their insertions, so that equal
+// inputs are saved byte for byte equal, e.g. for content-addressed
+// caching of the saved files. The nodes and the blocks are always
+// chosen this way, while the values added by InsertIn are otherwise
+// keyed by a rotating counter, which is not saved, so a cedar loaded
+// and then modified keys them differently from one never saved.
+// With it, each value takes the lowest free key instead, which costs
+// a scan over the used keys after it, once per freed key.
+func WithDeterministic() Option {
+	return func(da *Cedar) {
+		da.deterministic = true
+	}
+}
+
+// Allocator allocates the arrays of a cedar, e.g. from an arena or
+// a memory-mapped region outside of the Go heap, see WithAllocator.
+// Each method returns a zeroed slice of length `n`. The cedar copies
+// its nodes into the new slices when it grows, and drops the old ones.
+type Allocator interface {
+	AllocNodes(n int) []Node
+	AllocNInfos(n int) []NInfo
+	AllocBlocks(n int) []Block
+}
+
+// WithAllocator makes the cedar allocate its arrays with `a`,
+// instead of make, from its creation on.
+func WithAllocator(a Allocator) Option {
+	return func(da *Cedar) {
+		da.alloc = a
+		da.grow(da.Capacity)
+	}
+}
+
+// grow reallocates the arrays to hold `capacity` nodes.
+func (da *Cedar) grow(capacity int) {
+	da.Capacity = capacity
+
+	oldArray := da.Array
+	oldNinfo := da.Ninfos
+	oldBlock := da.Blocks
+	if da.alloc != nil {
+		da.Array = da.alloc.AllocNodes(da.Capacity)
+		da.Ninfos = da.alloc.AllocNInfos(da.Capacity)
+		da.Blocks = da.alloc.AllocBlocks(da.Capacity >> 8)
+	} else {
+		da.Array = make([]node, da.Capacity)
+		da.Ninfos = make([]ninfo, da.Capacity)
+		da.Blocks = make([]block, da.Capacity>>8)
+	}
+
+	copy(da.Array, oldArray)
+	copy(da.Ninfos, oldNinfo)
+	copy(da.Blocks, oldBlock)
+}
+
 // Get value by key, insert the key if not exist
-func (da *Cedar) get(key []byte, from, pos int) *int {
-	to := da.getV(key, from, pos)
-	return &da.Array[to].Value
+func (da *Cedar) get(key []byte, from, pos int) (*int, error) {
+	to, err := da.getV(key, from, pos)
+	if err != nil {
+		return nil, err
+	}
+	return &da.Array[to].Value, nil
 }
 
-// GetV value by key, insert the key if not exist
-func (da *Cedar) getV(key []byte, from, pos int) int {
+// GetV value by key, insert the key if not exist. It returns
+// ErrCapacityExceeded, releasing the nodes of the key which were added
+// without a value, if the cedar is full.
+func (da *Cedar) getV(key []byte, from, pos int) (int, error) {
 	for ; pos < len(key); pos++ {
-		if value := da.Array[from].Value; value >= 0 && value != ValueLimit {
-			to := da.follow(from, 0)
-			da.Array[to].Value = value
+		to, err := da.followKey(from, da.label(key[pos]))
+		if err != nil {
+			return 0, err
 		}
-		// key
-		from = da.follow(from, key[pos])
+		from = to
 	}
 
-	to := from
+	return da.terminal(from)
+}
+
+// followKey follows the byte of a key from the node `from`, adding
+// the node if needed, and moves the value of `from` to its terminal
+// child first. If the cedar is full, it releases `from`, if it was
+// added without a value.
+func (da *Cedar) followKey(from int, label byte) (int, error) {
+	if value := da.Array[from].Value; value >= 0 && value != ValueLimit {
+		to, err := da.follow(from, 0)
+		if err != nil {
+			return 0, err
+		}
+		da.Array[to].Value = value
+		// the value moves to the terminal child, so does its flag
+		da.Ninfos[to].End, da.Ninfos[from].End = da.Ninfos[from].End, false
+	}
+
+	to, err := da.follow(from, label)
+	if err != nil {
+		if da.Array[from].Value == ValueLimit {
+			da.release(from)
+		}
+		return 0, err
+	}
+
+	return to, nil
+}
+
+// terminal returns the node of the value of the key ending at `from`.
+func (da *Cedar) terminal(from int) (int, error) {
 	if da.Array[from].Value < 0 {
-		to = da.follow(from, 0)
+		return da.follow(from, 0)
 	}
 
-	return to
+	return from, nil
 }
 
 func (da *Cedar) vKey() int {
+	if da.deterministic {
+		k := da.vfree
+		if k < 1 {
+			k = 1
+		}
+		for {
+			if _, ok := da.vals[k]; !ok {
+				break
+			}
+			k++
+		}
+
+		da.vfree = k + 1
+		return k
+	}
+
 	k := da.vkey
 	for {
 		k = (k + 1) % da.Capacity
@@ -136,10 +319,24 @@ func (da *Cedar) vKey() int {
 	return k
 }
 
-func (da *Cedar) follow(from int, label byte) int {
+// freeVal drops the value of InsertIn with the key `k` from vals.
+func (da *Cedar) freeVal(k int) {
+	delete(da.vals, k)
+	if k < da.vfree {
+		da.vfree = k
+	}
+}
+
+func (da *Cedar) follow(from int, label byte) (int, error) {
 	base := da.Array[from].base()
 	to := base ^ int(label) // 对应状态转移关系： 「base[s]+c=t」，to 代表转移到的状态
 
+	// the root is never a child, so a parent without children which
+	// reaches it takes a new base, the others resolve the conflict below
+	if to == 0 && base >= 0 && da.Array[base^int(da.Ninfos[from].Child)].Check != from {
+		base = -1
+	}
+
 	// da.Array[to].Check < 0 : to 位置为空；
 	// base < 0：有 tail 数组？
 	if base < 0 || da.Array[to].Check < 0 {
@@ -149,20 +346,22 @@ func (da *Cedar) follow(from int, label byte) int {
 			// da.Array[i].Check == from 表示位置 i 处的状态由 from 处转移而来
 			hasChild = da.Array[i].Check == from
 		}
-		to = da.popEnode(base, from, label)
+		to, err := da.popEnode(base, from, label)
+		if err != nil {
+			return 0, err
+		}
 		da.pushSibling(from, to^int(label), label, hasChild)
 
-		return to
+		return to, nil
 	}
 
 	// Check 值不为负数，且父状态不是 from，则需要解决冲突
-	if da.Array[to].Check != from {
-		to = da.resolve(from, base, label)
-		return to
+	if da.Array[to].Check != from || to == 0 {
+		return da.resolve(from, base, label)
 	}
 
 	if da.Array[to].Check == from {
-		return to
+		return to, nil
 	}
 
 	panic("Cedar: internal error, should not be here")
@@ -195,23 +394,28 @@ func (da *Cedar) pushBlock(bi int, headOut *int, empty bool) {
 	}
 }
 
-func (da *Cedar) addBlock() int {
+// addBlock adds a block of free nodes, growing the arrays if needed.
+// It returns ErrCapacityExceeded, before changing anything, if the
+// arrays can not grow past the maximum capacity.
+func (da *Cedar) addBlock() (int, error) {
 	if da.Size == da.Capacity {
-		da.Capacity *= 2
-
-		oldArray := da.Array
-		da.Array = make([]node, da.Capacity)
-		copy(da.Array, oldArray)
+		capacity := da.Capacity * 2
+		if da.maxCapacity > 0 && capacity > da.maxCapacity {
+			capacity = da.maxCapacity
+		}
 
-		oldNinfo := da.Ninfos
-		da.Ninfos = make([]ninfo, da.Capacity)
-		copy(da.Ninfos, oldNinfo)
+		if capacity <= da.Capacity {
+			return 0, ErrCapacityExceeded
+		}
 
-		oldBlock := da.Blocks
-		da.Blocks = make([]block, da.Capacity>>8)
-		copy(da.Blocks, oldBlock)
+		oldCap := da.Capacity
+		da.grow(capacity)
+		if da.onGrow != nil {
+			da.onGrow(oldCap, capacity)
+		}
 	}
 
+	da.blocks++
 	da.Blocks[da.Size>>8].init()
 	da.Blocks[da.Size>>8].Ehead = da.Size
 
@@ -223,7 +427,24 @@ func (da *Cedar) addBlock() int {
 
 	da.pushBlock(da.Size>>8, &da.BheadO, da.BheadO == 0)
 	da.Size += 256
-	return da.Size>>8 - 1
+	return da.Size>>8 - 1, nil
+}
+
+// relinkBlocks rebuilds the lists of the Full, Closed and Open blocks
+// from the number of free nodes and trials of the blocks.
+func (da *Cedar) relinkBlocks() {
+	da.BheadF, da.BheadC, da.BheadO = 0, 0, 0
+	// the root block is never listed
+	for bi := 1; bi < da.Size>>8; bi++ {
+		head := &da.BheadO
+		if b := &da.Blocks[bi]; b.Num == 0 {
+			head = &da.BheadF
+		} else if b.Num == 1 || b.Trial >= da.MaxTrial {
+			head = &da.BheadC
+		}
+
+		da.pushBlock(bi, head, *head == 0)
+	}
 }
 
 func (da *Cedar) transferBlock(bi int, headIn, headOut *int) {
@@ -231,10 +452,13 @@ func (da *Cedar) transferBlock(bi int, headIn, headOut *int) {
 	da.pushBlock(bi, headOut, *headOut == 0 && da.Blocks[bi].Num != 0)
 }
 
-func (da *Cedar) popEnode(base, from int, label byte) int {
+func (da *Cedar) popEnode(base, from int, label byte) (int, error) {
 	e := base ^ int(label) // to：目的状态
 	if base < 0 {
-		e = da.findPlace()
+		var err error
+		if e, err = da.findPlace(); err != nil {
+			return 0, err
+		}
 	}
 
 	// block index
@@ -269,7 +493,7 @@ func (da *Cedar) popEnode(base, from int, label byte) int {
 		da.Array[from].Value = -(e ^ int(label)) - 1
 	}
 
-	return e
+	return e, nil
 }
 
 func (da *Cedar) pushEnode(e int) {
@@ -370,29 +594,31 @@ func (da *Cedar) setChild(base int, c, label byte, flag bool) []byte {
 	return child
 }
 
-func (da *Cedar) findPlace() int {
+func (da *Cedar) findPlace() (int, error) {
 	if da.BheadC != 0 {
-		return da.Blocks[da.BheadC].Ehead
+		return da.Blocks[da.BheadC].Ehead, nil
 	}
 
 	if da.BheadO != 0 {
-		return da.Blocks[da.BheadO].Ehead
+		return da.Blocks[da.BheadO].Ehead, nil
 	}
 
 	// 扩容？？？
-	return da.addBlock() << 8
+	bi, err := da.addBlock()
+	return bi << 8, err
 }
 
-func (da *Cedar) findPlaces(child []byte) int {
+func (da *Cedar) findPlaces(child []byte) (int, error) {
 	bi := da.BheadO
 	if bi != 0 {
 		e := da.listBi(bi, child)
 		if e > 0 {
-			return e
+			return e, nil
 		}
 	}
 
-	return da.addBlock() << 8
+	bi, err := da.addBlock()
+	return bi << 8, err
 }
 
 func (da *Cedar) listBi(bi int, child []byte) int {
@@ -449,11 +675,15 @@ func (da *Cedar) listEhead(b *block, child []byte) int {
 	return 0
 }
 
-func (da *Cedar) resolve(fromN, baseN int, labelN byte) int {
+func (da *Cedar) resolve(fromN, baseN int, labelN byte) (int, error) {
+	da.resolves++
 	toPn := baseN ^ int(labelN)
 	fromP := da.Array[toPn].Check
 	baseP := da.Array[fromP].base()
-	flag := da.consult(baseN, baseP, da.Ninfos[fromN].Child, da.Ninfos[fromP].Child)
+	// when the label leads to the root, fromP is fromN itself,
+	// and the children of fromN are moved
+	flag := fromP == fromN ||
+		da.consult(baseN, baseP, da.Ninfos[fromN].Child, da.Ninfos[fromP].Child)
 
 	var children []byte
 	if flag {
@@ -462,11 +692,18 @@ func (da *Cedar) resolve(fromN, baseN int, labelN byte) int {
 		children = da.setChild(baseP, da.Ninfos[fromP].Child, 255, false)
 	}
 
-	var base int
+	var (
+		base int
+		err  error
+	)
 	if len(children) == 1 {
-		base = da.findPlace()
+		base, err = da.findPlace()
 	} else {
-		base = da.findPlaces(children)
+		base, err = da.findPlaces(children)
+	}
+	if err != nil {
+		// nothing was moved yet
+		return 0, err
 	}
 	base ^= int(children[0])
 
@@ -492,16 +729,17 @@ func (da *Cedar) resolve(fromN, baseN int, labelN byte) int {
 		labelN, children, flag)
 
 	if flag {
-		return base ^ int(labelN)
+		return base ^ int(labelN), nil
 	}
 
-	return toPn
+	return toPn, nil
 }
 
 func (da *Cedar) list(base, from, nbase, fromN, toPn int,
 	labelN byte, children []byte, flag bool) (int, byte, int) {
 	for i := 0; i < len(children); i++ {
-		to := da.popEnode(base, from, children[i])
+		// the base was found free for all the children, so this never fails
+		to, _ := da.popEnode(base, from, children[i])
 		newTo := nbase ^ int(children[i])
 
 		if i == len(children)-1 {
@@ -517,6 +755,7 @@ func (da *Cedar) list(base, from, nbase, fromN, toPn int,
 		n := &da.Array[to]
 		ns := &da.Array[newTo]
 		n.Value = ns.Value
+		da.Ninfos[to].End = da.Ninfos[newTo].End
 
 		if n.Value < 0 && children[i] != 0 {
 			// this node has children, fix their check
@@ -75,3 +75,34 @@ func BenchmarkPrefixPredict(t *testing.B) {
 
 	tt.BM(t, fn)
 }
+
+func benchmarkLoadDensity(b *testing.B, opts ...Option) {
+	var c *Cedar
+	for i := 0; i < b.N; i++ {
+		c = New(opts...)
+		ch := make(chan KV)
+		go func() {
+			// an arbitrary order
+			for j := 0; j < 4096; j++ {
+				key := []byte{byte(j * 7919 % 251), byte(j), byte(j >> 4)}
+				ch <- KV{EscapeKey(key), j}
+			}
+			close(ch)
+		}()
+
+		if err := c.InsertChan(ch); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	_, nodes, size, _ := c.Status()
+	b.ReportMetric(float64(nodes)/float64(size), "density")
+}
+
+func BenchmarkLoadDensity(b *testing.B) {
+	benchmarkLoadDensity(b)
+}
+
+func BenchmarkLoadDensityCompact(b *testing.B) {
+	benchmarkLoadDensity(b, WithCompactOnLoad())
+}
@@ -1,9 +1,12 @@
 package cedar
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/vcaesar/tt"
@@ -43,7 +46,7 @@ func loadTestData() {
 	}
 
 	for _, word := range words {
-		if err := cd.Delete([]byte(word)); err != nil {
+		if err := cd.Delete([]byte(word)); err != nil && err != ErrNoPath {
 			panic(err)
 		}
 	}
@@ -142,6 +145,695 @@ func TestSaveAndLoad(t *testing.T) {
 	checkConsistency(daJson)
 }
 
+func TestInsertInFlag(t *testing.T) {
+	c := New()
+	end := func(key string) bool {
+		id, err := c.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		to, ok := c.valueNode(id)
+		tt.True(t, ok)
+		return c.Ninfos[to].End
+	}
+
+	// the value of "ab" moves to its terminal child
+	tt.Nil(t, c.InsertIn([]byte("ab"), "ab"))
+	tt.Nil(t, c.Insert([]byte("abc"), 1))
+	tt.True(t, end("ab"))
+	tt.False(t, end("abc"))
+
+	// and the children of "ab" are relocated by the new ones
+	for b := 'd'; b <= 'z'; b++ {
+		tt.Nil(t, c.Insert([]byte("ab"+string(b)), 1))
+	}
+	tt.True(t, end("ab"))
+
+	tt.Nil(t, c.Insert([]byte("ab"), 2))
+	tt.False(t, end("ab"))
+}
+
+func TestDeleteLastKey(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Delete([]byte("a")))
+	tt.Equal(t, 0, int(c.Ninfos[0].Child))
+
+	// the new child of the root is not its own sibling
+	tt.Nil(t, c.Insert([]byte("a"), 2))
+	id, err := c.Jump([]byte("a"), 0)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, int(c.Ninfos[id].Sibling))
+	tt.Equal(t, 1, len(c.PrefixPredict(nil, 0)))
+}
+
+func TestRootLabel(t *testing.T) {
+	c := New()
+	_, err := c.Jump([]byte{1}, 0)
+	tt.Equal(t, ErrNoPath, err)
+	_, ok := c.Step(0, 1)
+	tt.False(t, ok)
+
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Insert([]byte{1}, 2))
+	tt.Nil(t, c.Insert([]byte{1, 1}, 3))
+
+	for key, value := range map[string]int{"a": 1, "\x01": 2, "\x01\x01": 3} {
+		v, err := c.Get([]byte(key))
+		tt.Nil(t, err)
+		tt.Equal(t, value, v)
+	}
+
+	ids := c.PrefixPredict(nil, 0)
+	tt.Equal(t, 3, len(ids))
+	for i, key := range []string{"\x01", "\x01\x01", "a"} {
+		k, err := c.Key(ids[i])
+		tt.Nil(t, err)
+		tt.Equal(t, key, string(k))
+	}
+}
+
+func TestStep(t *testing.T) {
+	from := 0
+	for _, b := range []byte("abcd") {
+		to, ok := cd.Step(from, b)
+		tt.True(t, ok)
+		from = to
+	}
+
+	id, err := cd.Jump([]byte("abcd"), 0)
+	tt.Nil(t, err)
+	tt.Equal(t, id, from)
+
+	to, ok := cd.Step(from, 'x')
+	tt.False(t, ok)
+	tt.Equal(t, from, to)
+
+	id, err = cd.Jump([]byte("this is a sentence."), 0)
+	tt.Nil(t, err)
+	_, ok = cd.Step(id, '.')
+	tt.False(t, ok)
+}
+
+func TestZeroLabel(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("ab"), 7))
+	tt.Nil(t, c.Insert([]byte("abc"), 8))
+
+	id, err := c.Jump([]byte("ab"), 0)
+	tt.Nil(t, err)
+	_, ok := c.Step(id, 0)
+	tt.False(t, ok)
+
+	// the terminal child of "ab" is not the key "ab\x00"
+	text := []byte("ab\x00")
+	_, err = c.Get(text)
+	tt.Equal(t, ErrNoPath, err)
+	tt.False(t, c.Contains(text))
+	_, n, _ := c.JumpNode(text, 0)
+	tt.Equal(t, 2, n)
+	tt.Equal(t, 0, len(c.SegmentMatch(text, '/')))
+
+	var ends []int
+	c.TokenizeLongest(text, func(start, end, id int) {
+		ends = append(ends, end)
+	})
+	tt.Equal(t, []int{2}, ends)
+
+	ends = nil
+	tt.Nil(t, c.MatchAllReader(bytes.NewReader(text), func(id, start, end int) {
+		ends = append(ends, end)
+	}))
+	tt.Equal(t, []int{2}, ends)
+}
+
+func TestJumpNode(t *testing.T) {
+	id, n, ok := cd.JumpNode([]byte("太阳系金星"), 0)
+	tt.True(t, ok)
+	tt.Equal(t, len("太阳系"), n)
+	to, err := cd.Jump([]byte("太阳系"), 0)
+	tt.Nil(t, err)
+	tt.Equal(t, to, id)
+
+	// a node without a value
+	id, n, ok = cd.JumpNode([]byte("太阳"), 0)
+	tt.True(t, ok)
+	tt.Equal(t, len("太阳"), n)
+	_, err = cd.Value(id)
+	tt.Equal(t, ErrNoValue, err)
+
+	id, n, ok = cd.JumpNode([]byte("系水星"), id)
+	tt.True(t, ok)
+	tt.Equal(t, len("系水星"), n)
+	value, err := cd.Value(id)
+	tt.Nil(t, err)
+	tt.Equal(t, 17, value)
+
+	id, n, ok = cd.JumpNode([]byte("not found"), 0)
+	tt.False(t, ok)
+	tt.Equal(t, 0, id)
+	tt.Equal(t, 0, n)
+
+	_, _, ok = cd.JumpNode(nil, 0)
+	tt.True(t, ok)
+}
+
+func TestIsPrefix(t *testing.T) {
+	tt.True(t, cd.IsPrefix([]byte("ab"), 0))
+	tt.True(t, cd.IsPrefix([]byte("太阳"), 0))
+	tt.True(t, cd.IsPrefix([]byte("this is"), 0))
+	tt.True(t, cd.IsPrefix(nil, 0))
+	tt.False(t, cd.IsPrefix([]byte("abcdefghijklmn"), 0))
+	tt.False(t, cd.IsPrefix([]byte("xyz"), 0))
+	tt.False(t, cd.IsPrefix([]byte("not found"), 0))
+
+	from, err := cd.Jump([]byte("太阳"), 0)
+	tt.Nil(t, err)
+	tt.True(t, cd.IsPrefix([]byte("系"), from))
+	tt.False(t, cd.IsPrefix([]byte("系火星"), from))
+}
+
+func TestInsertChan(t *testing.T) {
+	c := New()
+	ch := make(chan KV)
+	go func() {
+		for i, word := range words {
+			ch <- KV{[]byte(word), i}
+		}
+		close(ch)
+	}()
+
+	err := c.InsertChan(ch)
+	tt.Nil(t, err)
+	for i, word := range words {
+		value, err := c.Get([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+
+	ch = make(chan KV, 3)
+	ch <- KV{[]byte("x"), 1}
+	ch <- KV{[]byte("y"), -1}
+	ch <- KV{[]byte("z"), 3}
+	close(ch)
+
+	err = c.InsertChan(ch)
+	tt.Equal(t, ErrInvalidValue, err)
+	_, err = c.Get([]byte("z"))
+	tt.NotNil(t, err)
+}
+
+func TestReadOnly(t *testing.T) {
+	c := New()
+	err := c.Insert([]byte("ab"), 1)
+	tt.Nil(t, err)
+
+	b, err := c.Bytes("gob")
+	tt.Nil(t, err)
+
+	c.SetReadOnly(true)
+	tt.True(t, c.ReadOnly())
+
+	tt.Equal(t, ErrReadOnly, c.Insert([]byte("abc"), 2))
+	tt.Equal(t, ErrReadOnly, c.InsertIn([]byte("abc"), "2"))
+	tt.Equal(t, ErrReadOnly, c.Update([]byte("ab"), 2))
+	tt.Equal(t, ErrReadOnly, c.Delete([]byte("ab")))
+	tt.Equal(t, ErrReadOnly, c.Load(bytes.NewReader(b), "gob"))
+
+	value, err := c.Get([]byte("ab"))
+	tt.Nil(t, err)
+	tt.Equal(t, 1, value)
+	_, err = c.Get([]byte("abc"))
+	tt.NotNil(t, err)
+
+	c.SetReadOnly(false)
+	tt.Nil(t, c.Update([]byte("ab"), 2))
+}
+
+func TestInsertSorted(t *testing.T) {
+	c := New()
+	c.MaxTrial = 2
+
+	for i, word := range []string{"", "a", "ab", "b"} {
+		err := c.InsertSorted([]byte(word), i)
+		tt.Nil(t, err)
+	}
+
+	tt.Equal(t, ErrNotSorted, c.InsertSorted([]byte("b"), 4))
+	tt.Equal(t, ErrNotSorted, c.InsertSorted([]byte("aa"), 4))
+	tt.Equal(t, ErrInvalidValue, c.InsertSorted([]byte("c"), -1))
+	tt.Nil(t, c.InsertSorted([]byte("c"), 4))
+
+	ids := c.PrefixPredict(nil, 0)
+	tt.Equal(t, 5, len(ids))
+
+	err := c.Clear()
+	tt.Nil(t, err)
+	tt.Equal(t, 2, c.MaxTrial)
+	keys, _, _, _ := c.Status()
+	tt.Equal(t, 0, keys)
+	_, err = c.Get([]byte("ab"))
+	tt.NotNil(t, err)
+
+	tt.Nil(t, c.InsertSorted([]byte("a"), 0))
+	value, err := c.Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Equal(t, 0, value)
+}
+
+func TestInsertMerge(t *testing.T) {
+	c := New()
+	sum := func(old, new int) int { return old + new }
+	max := func(old, new int) int {
+		if old > new {
+			return old
+		}
+		return new
+	}
+
+	for _, key := range []string{"a", "ab", "a", "a", "ab"} {
+		tt.Nil(t, c.InsertMerge([]byte(key), 1, sum))
+	}
+	tt.Nil(t, c.InsertMerge([]byte("b"), 5, max))
+	tt.Nil(t, c.InsertMerge([]byte("b"), 3, max))
+	tt.Nil(t, c.InsertIn([]byte("c"), "c"))
+	tt.Nil(t, c.InsertMerge([]byte("c"), 2, sum))
+
+	for key, v := range map[string]int{"a": 3, "ab": 2, "b": 5, "c": 2} {
+		value, err := c.Get([]byte(key))
+		tt.Nil(t, err)
+		tt.Equal(t, v, value)
+	}
+	tt.Equal(t, 4, c.NumKeys())
+
+	tt.Equal(t, ErrInvalidValue, c.InsertMerge([]byte("a"), 1,
+		func(old, new int) int { return -1 }))
+	value, err := c.Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Equal(t, 3, value)
+}
+
+func TestHooks(t *testing.T) {
+	c := New()
+	counts := make(map[string]int)
+	c.OnInsert(func(key []byte, value int) {
+		counts[string(key)] = value
+	})
+	c.OnDelete(func(key []byte) {
+		delete(counts, string(key))
+	})
+
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Update([]byte("a"), 2))
+	tt.Nil(t, c.Update([]byte("b"), 5))
+	tt.Nil(t, c.InsertIn([]byte("c"), "c"))
+	tt.Equal(t, map[string]int{"a": 3, "b": 5}, counts)
+
+	tt.Equal(t, ErrInvalidValue, c.Update([]byte("a"), -4))
+	tt.Equal(t, ErrNoPath, c.Delete([]byte("d")))
+	tt.Nil(t, c.Delete([]byte("b")))
+	tt.Equal(t, map[string]int{"a": 3}, counts)
+
+	c.OnInsert(nil)
+	c.OnDelete(nil)
+	tt.Nil(t, c.Insert([]byte("d"), 1))
+	tt.Nil(t, c.Delete([]byte("a")))
+	tt.Equal(t, map[string]int{"a": 3}, counts)
+}
+
+func TestValueLen(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.InsertIn([]byte("abc"), "x"))
+	tt.Nil(t, c.InsertInLen([]byte("ab"), "y", 7))
+	tt.Nil(t, c.Insert([]byte("b"), 1))
+
+	for key, n := range map[string]int{"abc": 3, "ab": 7} {
+		id, err := c.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		length, err := c.ValueLen(id)
+		tt.Nil(t, err)
+		tt.Equal(t, n, length)
+	}
+
+	id, err := c.Jump([]byte("b"), 0)
+	tt.Nil(t, err)
+	_, err = c.ValueLen(id)
+	tt.Equal(t, ErrNoValue, err)
+
+	sub := c.SubTrie([]byte("a"), 0)
+	id, err = sub.Jump([]byte("b"), 0)
+	tt.Nil(t, err)
+	length, err := sub.ValueLen(id)
+	tt.Nil(t, err)
+	tt.Equal(t, 7, length)
+}
+
+func TestEachBlock(t *testing.T) {
+	var blocks []BlockInfo
+	cd.EachBlock(func(b BlockInfo) bool {
+		blocks = append(blocks, b)
+		return true
+	})
+
+	tt.Equal(t, cd.Size>>8, len(blocks))
+	for i, b := range blocks {
+		tt.Equal(t, i, b.Index)
+		tt.Equal(t, i*256, b.Begin)
+		tt.Equal(t, 256, b.End-b.Begin)
+
+		n := 0
+		for _, node := range cd.Array[b.Begin:b.End] {
+			if node.Check < 0 {
+				n++
+			}
+		}
+		tt.Equal(t, n, b.Free)
+
+		tt.Equal(t, 256, len(b.Nodes))
+		tt.Equal(t, 256, len(b.NInfos))
+		tt.Equal(t, cd.Array[b.Begin+255], b.Nodes[255])
+		tt.Equal(t, cd.Ninfos[b.Begin+255], b.NInfos[255])
+		tt.Equal(t, cd.Blocks[i], b.Block)
+	}
+
+	n := 0
+	cd.EachBlock(func(b BlockInfo) bool {
+		n++
+		return false
+	})
+	tt.Equal(t, 1, n)
+}
+
+func TestMaxNodes(t *testing.T) {
+	c := New(WithMaxNodes(700))
+	tt.Equal(t, 256, c.Capacity)
+
+	var err error
+	n := 0
+	for ; n < 1000; n++ {
+		err = c.Insert([]byte(fmt.Sprintf("%03dkey", n)), n)
+		if err != nil {
+			break
+		}
+	}
+	tt.Equal(t, ErrCapacityExceeded, err)
+	tt.Equal(t, 768, c.Capacity)
+	tt.Equal(t, 768, len(c.Array))
+
+	tt.Equal(t, n, c.NumKeys())
+	for i := 0; i < n; i++ {
+		value, err := c.Get([]byte(fmt.Sprintf("%03dkey", i)))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+	tt.Nil(t, c.checkInvariants())
+
+	tt.Equal(t, 256, New(WithMaxNodes(1)).maxCapacity)
+	tt.Equal(t, 0, New(WithMaxNodes(0)).maxCapacity)
+	tt.Equal(t, 0, New(WithMaxNodes(-1)).maxCapacity)
+}
+
+func TestNewFixed(t *testing.T) {
+	c := NewFixed(300)
+	tt.Equal(t, 512, c.Capacity)
+	tt.Equal(t, 256, c.Size)
+
+	var err error
+	n := 0
+	for ; n < 1000; n++ {
+		err = c.Insert([]byte(fmt.Sprintf("%03dkey", n)), n)
+		if err != nil {
+			break
+		}
+	}
+	tt.Equal(t, ErrCapacityExceeded, err)
+	tt.Equal(t, 512, c.Capacity)
+	tt.Equal(t, 512, len(c.Array))
+
+	keys, _, _, _ := c.Status()
+	tt.Equal(t, n, keys)
+	tt.Equal(t, n, len(c.PrefixPredict(nil, 0)))
+	for i := 0; i < n; i++ {
+		value, err := c.Get([]byte(fmt.Sprintf("%03dkey", i)))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+
+	tt.Equal(t, ErrCapacityExceeded, c.Update([]byte("overflow key"), 1))
+	tt.Equal(t, ErrCapacityExceeded, c.InsertIn([]byte("overflow key"), 1))
+	_, err = c.Jump([]byte("o"), 0)
+	tt.Equal(t, ErrNoPath, err)
+	tt.Equal(t, 0, len(c.vals))
+	tt.Nil(t, c.checkInvariants())
+
+	err = c.Delete([]byte("000key"))
+	tt.Nil(t, err)
+	err = c.Insert([]byte("000key"), 0)
+	tt.Nil(t, err)
+}
+
+func TestNewFixedKeepsCapacity(t *testing.T) {
+	grows := 0
+	c := NewFixed(8192, WithCompactOnLoad())
+	c.OnGrow(func(oldCap, newCap int) { grows++ })
+	insert := func() {
+		for i := 0; i < 500; i++ {
+			tt.Nil(t, c.Insert([]byte(fmt.Sprintf("key%d", i)), i))
+		}
+	}
+
+	insert()
+	tt.Nil(t, c.Compact())
+	tt.Equal(t, 8192, c.Capacity)
+	insert()
+
+	b, err := c.Bytes("gob")
+	tt.Nil(t, err)
+	tt.Nil(t, c.Load(bytes.NewReader(b), "gob"))
+	tt.Equal(t, 8192, c.Capacity)
+	insert()
+
+	tt.Nil(t, c.Clear())
+	tt.Equal(t, 8192, c.Capacity)
+	insert()
+
+	r := c.Rebuild(4)
+	tt.Equal(t, 8192, r.Capacity)
+	tt.Equal(t, 8192, r.maxCapacity)
+	tt.Equal(t, 0, grows)
+	tt.Nil(t, c.checkInvariants())
+}
+
+func TestCompactFull(t *testing.T) {
+	for _, c := range []*Cedar{New(WithMaxNodes(1024)), NewFixed(1024)} {
+		r := rand.New(rand.NewSource(1))
+		keys := make(map[string]int)
+		for i := 0; ; i++ {
+			key := make([]byte, 2+r.Intn(6))
+			for j := range key {
+				key[j] = byte(1 + r.Intn(255))
+			}
+			if c.Insert(key, i) != nil {
+				break
+			}
+			keys[string(key)] = i
+		}
+
+		// these keys need more nodes when inserted in order,
+		// so the cedar is kept as it is
+		tt.Equal(t, ErrCapacityExceeded, c.Compact())
+		tt.Equal(t, len(keys), c.NumKeys())
+		rebuilt := c.Rebuild(c.MaxTrial)
+		tt.Equal(t, len(keys), rebuilt.NumKeys())
+		tt.True(t, rebuilt.Capacity > 1024)
+		tt.Equal(t, 1024, rebuilt.maxCapacity)
+		for key, value := range keys {
+			v, err := c.Get([]byte(key))
+			tt.Nil(t, err)
+			tt.Equal(t, value, v)
+		}
+		tt.Nil(t, c.checkInvariants())
+
+		b, err := c.Bytes("gob")
+		tt.Nil(t, err)
+		n := NewFixed(1024, WithCompactOnLoad())
+		tt.Nil(t, n.Load(bytes.NewReader(b), "gob"))
+		tt.Equal(t, len(keys), n.NumKeys())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	loadTestData()
+
+	for _, dataType := range []string{"gob", "json"} {
+		b, err := cd.Bytes(dataType)
+		tt.Nil(t, err)
+
+		da, err := FromBytes(b, dataType)
+		tt.Nil(t, err)
+		checkConsistency(da)
+	}
+
+	_, err := cd.Bytes("xml")
+	tt.Equal(t, ErrInvalidDataType, err)
+	_, err = FromBytes(nil, "xml")
+	tt.Equal(t, ErrInvalidDataType, err)
+}
+
+func TestRecountKeys(t *testing.T) {
+	c := New()
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+
+	// a cedar whose fields were set directly
+	d := New()
+	d.Array, d.Ninfos, d.Blocks = c.Array, c.Ninfos, c.Blocks
+	d.Size, d.Capacity = c.Size, c.Capacity
+	tt.Equal(t, 0, d.NumKeys())
+	tt.Equal(t, len(words), d.RecountKeys())
+	tt.Equal(t, len(words), d.NumKeys())
+
+	tt.Nil(t, d.Delete([]byte(words[0])))
+	tt.Equal(t, len(words)-1, d.NumKeys())
+}
+
+func TestTotalKeyBytes(t *testing.T) {
+	n := 0
+	for i, word := range words {
+		if i%4 != 0 {
+			n += len(word)
+		}
+	}
+	tt.Equal(t, n, cd.TotalKeyBytes())
+
+	c := New()
+	tt.Equal(t, 0, c.TotalKeyBytes())
+	tt.Nil(t, c.Insert([]byte("ab"), 1))
+	tt.Nil(t, c.InsertIn([]byte("abc"), "abc"))
+	tt.Equal(t, 5, c.TotalKeyBytes())
+}
+
+func TestPrefixCount(t *testing.T) {
+	keys, _, _, _ := cd.Status()
+	tt.Equal(t, keys, cd.NumKeys())
+
+	tt.Equal(t, 3, cd.PrefixCount([]byte("太阳"), 0))
+	tt.Equal(t, keys, cd.PrefixCount(nil, 0))
+	tt.Equal(t, 0, cd.PrefixCount([]byte("not found"), 0))
+	tt.Equal(t, 3.0/float64(keys), cd.PrefixSelectivity([]byte("太阳"), 0))
+	tt.Equal(t, 0, cd.PrefixSelectivity([]byte("not found"), 0))
+
+	c := New()
+	tt.Equal(t, 0, c.PrefixSelectivity(nil, 0))
+	for i := 0; i < 5000; i++ {
+		tt.Nil(t, c.Insert([]byte(fmt.Sprintf("x%04d", i)), i))
+		tt.Nil(t, c.Insert([]byte(fmt.Sprintf("y%04d", i)), i))
+	}
+	tt.Nil(t, c.Update([]byte("y0000"), 1))
+	tt.Nil(t, c.InsertIn([]byte("z"), "z"))
+	tt.Nil(t, c.Delete([]byte("z")))
+	tt.Equal(t, 10000, c.NumKeys())
+
+	tt.Equal(t, 5000, c.PrefixCount([]byte("x"), 0))
+	tt.Equal(t, 0.5, c.PrefixSelectivity([]byte("x"), 0))
+	tt.Equal(t, 0.01, c.PrefixSelectivity([]byte("x00"), 0))
+}
+
+func TestExtensions(t *testing.T) {
+	ids := cd.Extensions([]byte("太阳系"), 0)
+	check(cd, ids, []string{"太阳系水星", "太阳系火星"}, []int{17, 18})
+
+	from, err := cd.Jump([]byte("太阳"), 0)
+	tt.Nil(t, err)
+	ids = cd.Extensions([]byte("系"), from)
+	check(cd, ids, []string{"太阳系水星", "太阳系火星"}, []int{17, 18})
+
+	ids = cd.Extensions([]byte("this is a sentence."), 0)
+	tt.Equal(t, 0, len(ids))
+	ids = cd.Extensions([]byte("not found"), 0)
+	tt.Equal(t, 0, len(ids))
+}
+
+func TestCompleteSuffixes(t *testing.T) {
+	suffixes := cd.CompleteSuffixes([]byte("太阳"), 0, 0)
+	tt.Equal(t, []string{"系", "系水星", "系火星"}, toStrings(suffixes))
+
+	suffixes = cd.CompleteSuffixes([]byte("太阳"), 0, 2)
+	tt.Equal(t, []string{"系", "系水星"}, toStrings(suffixes))
+
+	from, err := cd.Jump([]byte("this"), 0)
+	tt.Nil(t, err)
+	suffixes = cd.CompleteSuffixes([]byte(" is"), from, 0)
+	tt.Equal(t, []string{" a sentence."}, toStrings(suffixes))
+
+	suffixes = cd.CompleteSuffixes([]byte("not found"), 0, 0)
+	tt.Equal(t, 0, len(suffixes))
+}
+
+func TestBlockOccupancy(t *testing.T) {
+	c := New()
+	occ := c.BlockOccupancy()
+	tt.Equal(t, 1, len(occ))
+	tt.Equal(t, 1.0/256, occ[0])
+
+	err := c.Insert([]byte("ab"), 1)
+	tt.Nil(t, err)
+
+	_, nodes, size, _ := c.Status()
+	occ = c.BlockOccupancy()
+	tt.Equal(t, size>>8, len(occ))
+
+	used := 0.0
+	for _, o := range occ {
+		used += o * 256
+	}
+	tt.Equal(t, nodes, int(used))
+}
+
+func TestFragmentation(t *testing.T) {
+	c := New()
+	tt.Equal(t, 255.0/256, c.Fragmentation())
+
+	for i, word := range words {
+		err := c.Insert([]byte(word), i)
+		tt.Nil(t, err)
+	}
+	full := c.Fragmentation()
+	tt.True(t, full < 1)
+
+	for _, word := range words {
+		err := c.Delete([]byte(word))
+		tt.Nil(t, err)
+	}
+	tt.True(t, c.Fragmentation() > full)
+}
+
+func TestLookupBatchMasked(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("aa"), []byte("ab"),
+		[]byte("abc"), []byte("abcd"), []byte("x")}
+
+	values, found := cd.LookupBatchMasked(keys)
+	tt.Equal(t, []int{0, 1, 2, 0, 6, 0}, values)
+	tt.Equal(t, []bool{false, true, true, false, true, false}, found)
+
+	c := New()
+	err := c.Insert([]byte("a"), 0)
+	tt.Nil(t, err)
+	values, found = c.LookupBatchMasked(keys[:2])
+	tt.Equal(t, []int{0, 0}, values)
+	tt.Equal(t, []bool{true, false}, found)
+
+	var batch [][]byte
+	for i := len(words) - 1; i >= 0; i-- {
+		batch = append(batch, []byte(words[i]), []byte(words[i]+"?"))
+	}
+	values, found = cd.LookupBatchMasked(batch)
+	for i, key := range batch {
+		value, err := cd.Get(key)
+		tt.Equal(t, err == nil, found[i])
+		tt.Equal(t, value, values[i])
+	}
+}
+
 func TestPrefixMatch(t *testing.T) {
 	var (
 		ids, values []int
@@ -164,45 +856,406 @@ func TestPrefixMatch(t *testing.T) {
 	check(cd, ids, keys, values)
 }
 
-func TestOrder(t *testing.T) {
-	c := New()
-	err := c.Insert([]byte("a"), 1)
-	tt.Nil(t, err)
-	err = c.Insert([]byte("b"), 3)
-	tt.Nil(t, err)
-	err = c.Insert([]byte("d"), 6)
-	tt.Nil(t, err)
+func TestPrefixMatchLens(t *testing.T) {
+	ids, lens := cd.PrefixMatchLens([]byte("abcdefg"), 0)
+	check(cd, ids, []string{"ab", "abcd", "abcde", "abcdef"}, []int{2, 6, 10, 9})
+	tt.Equal(t, []int{2, 4, 5, 6}, lens)
 
-	err = c.Insert([]byte("ab"), 2)
-	tt.Nil(t, err)
-	err = c.Insert([]byte("c"), 5)
+	from, err := cd.Jump([]byte("新"), 0)
 	tt.Nil(t, err)
-	err = c.Insert([]byte(""), 0)
+	ids, lens = cd.PrefixMatchLens([]byte("星联邦共和国"), from)
+	check(cd, ids, []string{"新星", "新星联邦共和国"}, []int{19, 22})
+	tt.Equal(t, []int{3, 18}, lens)
+}
+
+func TestPrefixMatchResume(t *testing.T) {
+	ids, last, n := cd.PrefixMatchResume([]byte("abcdefg"), 0)
+	check(cd, ids, []string{"ab", "abcd", "abcde", "abcdef"}, []int{2, 6, 10, 9})
+	tt.Equal(t, 7, n)
+	id, err := cd.Jump([]byte("abcdefg"), 0)
 	tt.Nil(t, err)
-	err = c.Insert([]byte("bb"), 4)
+	tt.Equal(t, id, last)
+
+	ids, _, n = cd.PrefixMatchResume([]byte("hijklmnop"), last)
+	check(cd, ids, []string{"abcdefghijklmn"}, []int{11})
+	tt.Equal(t, 7, n)
+
+	from, err := cd.Jump([]byte("太阳"), 0)
 	tt.Nil(t, err)
+	ids, last, n = cd.PrefixMatchResume([]byte("x"), from)
+	tt.Equal(t, 0, len(ids))
+	tt.Equal(t, from, last)
+	tt.Equal(t, 0, n)
+}
 
-	ids := c.PrefixPredict([]byte(""), 0)
-	if len(ids) != 7 {
-		panic("wrong order")
+func TestPrefixMatchBatch(t *testing.T) {
+	keys := [][]byte{
+		[]byte("abcdefg"), []byte("not found"), nil,
+		[]byte("新星联邦共和国"), []byte("this is a sentence."),
 	}
 
-	for i, n := range ids {
-		val, _ := c.Value(n)
-		if i != val {
-			panic("wrong order")
-		}
+	matches := cd.PrefixMatchBatch(keys)
+	tt.Equal(t, len(keys), len(matches))
+	for i, key := range keys {
+		tt.Equal(t, cd.PrefixMatch(key, 0), matches[i])
 	}
+	tt.Equal(t, 0, len(matches[1]))
+	tt.Equal(t, len(matches[3]), cap(matches[3]))
 }
 
-func TestPrefixPredict(t *testing.T) {
-	var (
-		ids    []int
-		keys   []string
-		values []int
-	)
+func TestSplitByCount(t *testing.T) {
+	c := New()
+	for i, word := range []string{"a", "b", "c", "d", "e", "f"} {
+		err := c.Insert([]byte(word), i)
+		tt.Nil(t, err)
+	}
 
-	ids = cd.PrefixPredict([]byte("新星"), 0)
+	str := func(bounds [][]byte) (keys []string) {
+		for _, b := range bounds {
+			keys = append(keys, string(b))
+		}
+		return
+	}
+
+	tt.Equal(t, []string{"c", "e"}, str(c.SplitByCount(3)))
+	tt.Equal(t, []string{"b", "d", "e"}, str(c.SplitByCount(4)))
+	tt.Equal(t, []string{"b", "c", "d", "e", "f"}, str(c.SplitByCount(10)))
+	tt.Equal(t, 0, len(c.SplitByCount(1)))
+}
+
+func TestSubtreeNodeCount(t *testing.T) {
+	c := New()
+	tt.Equal(t, 1, c.SubtreeNodeCount(nil, 0))
+
+	for i, word := range []string{"ab", "abc", "abd", "b"} {
+		err := c.Insert([]byte(word), i)
+		tt.Nil(t, err)
+	}
+
+	// root, a, b, ab, ab\0, abc, abd
+	tt.Equal(t, 7, c.SubtreeNodeCount(nil, 0))
+	tt.Equal(t, 4, c.SubtreeNodeCount([]byte("ab"), 0))
+	tt.Equal(t, 1, c.SubtreeNodeCount([]byte("abc"), 0))
+	tt.Equal(t, 0, c.SubtreeNodeCount([]byte("x"), 0))
+
+	from, err := c.Jump([]byte("a"), 0)
+	tt.Nil(t, err)
+	tt.Equal(t, 4, c.SubtreeNodeCount([]byte("b"), from))
+
+	_, nodes, _, _ := c.Status()
+	tt.Equal(t, nodes, c.SubtreeNodeCount(nil, 0))
+}
+
+func TestSubTrie(t *testing.T) {
+	sub := cd.SubTrie([]byte("新星"), 0)
+	ids := sub.PrefixPredict(nil, 0)
+	check(sub, ids, []string{"", "军团", "联邦共和国"}, []int{19, 21, 22})
+
+	value, err := sub.Get([]byte(""))
+	tt.Nil(t, err)
+	tt.Equal(t, 19, value)
+
+	for _, id := range cd.PrefixPredict([]byte("新星"), 0) {
+		key, err := cd.Key(id)
+		tt.Nil(t, err)
+		v1, _ := cd.Value(id)
+		v2, err := sub.Get(key[len("新星"):])
+		tt.Nil(t, err)
+		tt.Equal(t, v1, v2)
+	}
+
+	from, err := cd.Jump([]byte("ab"), 0)
+	tt.Nil(t, err)
+	sub = cd.SubTrie([]byte("cd"), from)
+	ids = sub.PrefixPredict(nil, 0)
+	check(sub, ids, []string{"", "e", "ef", "efghijklmn"}, []int{6, 10, 9, 11})
+
+	sub = cd.SubTrie([]byte("not found"), 0)
+	tt.Equal(t, 0, len(sub.PrefixPredict([]byte("a"), 0)))
+
+	c := New()
+	err = c.InsertIn([]byte("ab"), "x")
+	tt.Nil(t, err)
+	err = c.InsertIn([]byte("abc"), "y")
+	tt.Nil(t, err)
+
+	sub = c.SubTrie([]byte("a"), 0)
+	for key, value := range map[string]string{"b": "x", "bc": "y"} {
+		id, err := sub.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		id, ok := sub.valueNode(id)
+		tt.True(t, ok)
+		tt.True(t, sub.Ninfos[id].End)
+		tt.Equal(t, value, sub.vals[sub.Array[id].Value].Value)
+	}
+}
+
+func TestWithCommonPrefix(t *testing.T) {
+	n := cd.WithCommonPrefix([]byte("ns/"))
+	keys, _, _, _ := cd.Status()
+	nkeys, _, _, _ := n.Status()
+	tt.Equal(t, keys, nkeys)
+
+	for _, id := range cd.PrefixPredict(nil, 0) {
+		key, _ := cd.Key(id)
+		v1, _ := cd.Value(id)
+		v2, err := n.Get(append([]byte("ns/"), key...))
+		tt.Nil(t, err)
+		tt.Equal(t, v1, v2)
+	}
+
+	sub := n.SubTrie([]byte("ns/"), 0)
+	checkConsistency(sub)
+}
+
+func TestForEach(t *testing.T) {
+	var keys []string
+	cd.ForEach(func(key []byte, value int) bool {
+		tt.Equal(t, words[value], string(key))
+		keys = append(keys, string(key))
+		return true
+	})
+	tt.Equal(t, len(cd.PrefixPredict(nil, 0)), len(keys))
+
+	keys = nil
+	cd.ForEach(func(key []byte, value int) bool {
+		keys = append(keys, string(key))
+		return len(keys) < 3
+	})
+	tt.Equal(t, []string{"aa", "ab", "abcd"}, keys)
+}
+
+func TestKeysAfter(t *testing.T) {
+	var all []string
+	for _, id := range cd.PrefixPredict(nil, 0) {
+		key, err := cd.Key(id)
+		tt.Nil(t, err)
+		all = append(all, string(key))
+	}
+
+	afters := append([]string{"", "a", "abcd", "abz", "b", "太", "zzz", "\xff"}, words...)
+	for _, after := range afters {
+		var want []string
+		for _, key := range all {
+			if key > after {
+				want = append(want, key)
+			}
+		}
+
+		tt.Equal(t, want, toStrings(cd.KeysAfter([]byte(after), 0)))
+		if len(want) > 2 {
+			want = want[:2]
+		}
+		tt.Equal(t, want, toStrings(cd.KeysAfter([]byte(after), 2)))
+	}
+
+	// paginate
+	var pages []string
+	for after := []byte(nil); ; {
+		page := cd.KeysAfter(after, 3)
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, toStrings(page)...)
+		after = page[len(page)-1]
+	}
+	tt.Equal(t, all, pages)
+
+	c := New()
+	c.Ordered = false
+	for i, key := range []string{"a", "c", "b", "ab", "aa"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	pages = nil
+	for after := []byte(nil); ; {
+		page := c.KeysAfter(after, 1)
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, toStrings(page)...)
+		after = page[0]
+	}
+	tt.Equal(t, []string{"a", "aa", "ab", "b", "c"}, pages)
+}
+
+func TestSample(t *testing.T) {
+	all := cd.PrefixPredict(nil, 0)
+	tt.Equal(t, all, cd.Sample(len(all)+1, 1))
+	tt.Equal(t, 0, len(cd.Sample(0, 1)))
+
+	ids := cd.Sample(5, 1)
+	tt.Equal(t, 5, len(ids))
+	tt.Equal(t, ids, cd.Sample(5, 1))
+
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		tt.False(t, seen[id])
+		seen[id] = true
+
+		_, err := cd.Value(id)
+		tt.Nil(t, err)
+	}
+
+	// every key is sampled about as often
+	c := New()
+	for i := 0; i < 10; i++ {
+		tt.Nil(t, c.Insert([]byte{'a' + byte(i)}, i))
+	}
+	counts := make(map[int]int)
+	for seed := int64(0); seed < 1000; seed++ {
+		for _, id := range c.Sample(3, seed) {
+			value, _ := c.Value(id)
+			counts[value]++
+		}
+	}
+	for i := 0; i < 10; i++ {
+		tt.True(t, counts[i] > 200 && counts[i] < 400)
+	}
+}
+
+func TestDeleteByValue(t *testing.T) {
+	c := New()
+	for _, word := range []string{"a", "ab", "abc", "b", "bc"} {
+		tt.Nil(t, c.Insert([]byte(word), len(word)%2))
+	}
+	tt.Nil(t, c.InsertIn([]byte("c"), 1))
+
+	n, err := c.DeleteByValue(1)
+	tt.Nil(t, err)
+	tt.Equal(t, 3, n)
+
+	var keys []string
+	c.ForEach(func(key []byte, value int) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	tt.Equal(t, []string{"ab", "bc"}, keys)
+
+	_, err = c.Jump([]byte("c"), 0)
+	tt.Nil(t, err)
+
+	n, err = c.DeleteByValue(5)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, n)
+}
+
+func TestRebuild(t *testing.T) {
+	_, nodes, size, _ := cd.Status()
+	n := cd.Rebuild(8)
+	tt.Equal(t, 8, n.MaxTrial)
+	tt.Equal(t, 1, cd.MaxTrial)
+	checkConsistency(n)
+	checkConsistency(cd)
+
+	_, nnodes, nsize, _ := n.Status()
+	tt.True(t, nnodes <= nodes)
+	tt.True(t, nsize <= size)
+}
+
+func TestCompact(t *testing.T) {
+	b, err := cd.Bytes("gob")
+	tt.Nil(t, err)
+	c, err := FromBytes(b, "gob")
+	tt.Nil(t, err)
+
+	for i := 0; i < len(words); i += 2 {
+		c.Delete([]byte(words[i]))
+	}
+	_, nodes, _, _ := c.Status()
+
+	tt.Nil(t, c.Compact())
+	tt.Nil(t, c.checkInvariants())
+	_, cnodes, _, _ := c.Status()
+	tt.True(t, cnodes <= nodes)
+
+	for i, word := range words {
+		value, err := c.Get([]byte(word))
+		if i%2 == 0 {
+			tt.NotNil(t, err)
+			continue
+		}
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+
+	l := New(WithCompactOnLoad())
+	tt.Nil(t, l.Load(bytes.NewReader(b), "gob"))
+	checkConsistency(l)
+	tt.Nil(t, l.checkInvariants())
+
+	c.SetReadOnly(true)
+	tt.Equal(t, ErrReadOnly, c.Compact())
+}
+
+func TestIntersects(t *testing.T) {
+	c := New()
+	tt.False(t, c.Intersects(cd))
+	tt.False(t, cd.Intersects(c))
+
+	for _, word := range []string{"abc", "x", "太阳"} {
+		err := c.Insert([]byte(word), 1)
+		tt.Nil(t, err)
+	}
+	tt.False(t, c.Intersects(cd))
+	tt.False(t, cd.Intersects(c))
+
+	err := c.Insert([]byte("新星军团"), 1)
+	tt.Nil(t, err)
+	tt.True(t, c.Intersects(cd))
+	tt.True(t, cd.Intersects(c))
+
+	// a key added by InsertIn, without counting an access
+	small := New()
+	tt.Nil(t, small.Insert([]byte("b"), 1))
+	large := New(WithCapacityLimit(2), WithAccessTracking())
+	tt.Nil(t, large.InsertIn([]byte("b"), "b"))
+	tt.Nil(t, large.Insert([]byte("c"), 1))
+	tt.True(t, small.Intersects(large))
+	tt.Nil(t, large.Insert([]byte("d"), 1))
+	tt.False(t, large.Contains([]byte("b")))
+	tt.True(t, large.Contains([]byte("c")))
+}
+
+func TestOrder(t *testing.T) {
+	c := New()
+	err := c.Insert([]byte("a"), 1)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("b"), 3)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("d"), 6)
+	tt.Nil(t, err)
+
+	err = c.Insert([]byte("ab"), 2)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("c"), 5)
+	tt.Nil(t, err)
+	err = c.Insert([]byte(""), 0)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("bb"), 4)
+	tt.Nil(t, err)
+
+	ids := c.PrefixPredict([]byte(""), 0)
+	if len(ids) != 7 {
+		panic("wrong order")
+	}
+
+	for i, n := range ids {
+		val, _ := c.Value(n)
+		if i != val {
+			panic("wrong order")
+		}
+	}
+}
+
+func TestPrefixPredict(t *testing.T) {
+	var (
+		ids    []int
+		keys   []string
+		values []int
+	)
+
+	ids = cd.PrefixPredict([]byte("新星"), 0)
 	keys = []string{"新星", "新星军团", "新星联邦共和国"}
 	values = []int{19, 21, 22}
 	check(cd, ids, keys, values)
@@ -212,3 +1265,951 @@ func TestPrefixPredict(t *testing.T) {
 	values = []int{15, 17, 18}
 	check(cd, ids, keys, values)
 }
+
+func TestPrefixPredictOrdered(t *testing.T) {
+	byLen := func(a, b []byte) bool {
+		return len(a) > len(b)
+	}
+
+	ids := cd.PrefixPredictOrdered([]byte("ab"), 0, byLen)
+	keys := []string{"abcdefghijklmn", "abcdef", "abcde",
+		"abcd", "abde", "abd", "ab"}
+	values := []int{11, 9, 10, 6, 7, 5, 2}
+	check(cd, ids, keys, values)
+
+	from, err := cd.Jump([]byte("新"), 0)
+	tt.Nil(t, err)
+	ids = cd.PrefixPredictOrdered([]byte("星"), from, byLen)
+	keys = []string{"新星联邦共和国", "新星军团", "新星"}
+	values = []int{22, 21, 19}
+	check(cd, ids, keys, values)
+
+	ids = cd.PrefixPredictOrdered([]byte("not found"), 0, byLen)
+	tt.Equal(t, 0, len(ids))
+}
+
+func TestPrefixPredictSelf(t *testing.T) {
+	var (
+		ids    []int
+		keys   []string
+		values []int
+	)
+
+	ids = cd.PrefixPredictSelf([]byte("新星"), 0, true)
+	keys = []string{"新星", "新星军团", "新星联邦共和国"}
+	values = []int{19, 21, 22}
+	check(cd, ids, keys, values)
+
+	ids = cd.PrefixPredictSelf([]byte("新星"), 0, false)
+	keys = []string{"新星军团", "新星联邦共和国"}
+	values = []int{21, 22}
+	check(cd, ids, keys, values)
+
+	ids = cd.PrefixPredictSelf([]byte("新星"), 1, false)
+	keys = []string{"新星军团"}
+	values = []int{21}
+	check(cd, ids, keys, values)
+
+	ids = cd.PrefixPredictSelf([]byte("新星联邦共和国"), 0, false)
+	tt.Equal(t, 0, len(ids))
+
+	// "abc" was deleted, so there is nothing to exclude
+	ids = cd.PrefixPredictSelf([]byte("abc"), 0, false)
+	keys = []string{"abcd", "abcde", "abcdef", "abcdefghijklmn"}
+	values = []int{6, 10, 9, 11}
+	check(cd, ids, keys, values)
+}
+
+func TestAutoValue(t *testing.T) {
+	c := New()
+	for i, key := range []string{"a", "ab", "b"} {
+		value, err := c.AutoValue([]byte(key))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+
+	value, err := c.AutoValue([]byte("ab"))
+	tt.Nil(t, err)
+	tt.Equal(t, 1, value)
+
+	tt.Nil(t, c.Insert([]byte("c"), 10))
+	tt.Nil(t, c.Delete([]byte("c")))
+	value, _ = c.AutoValue([]byte("d"))
+	tt.Equal(t, 11, value)
+
+	var buf bytes.Buffer
+	tt.Nil(t, c.Save(&buf, "gob"))
+	d := New()
+	tt.Nil(t, d.Load(&buf, "gob"))
+	value, _ = d.AutoValue([]byte("e"))
+	tt.Equal(t, 12, value)
+
+	_, err = c.AutoValue([]byte("a\x00"))
+	tt.Equal(t, ErrInvalidKey, err)
+	tt.Nil(t, c.Clear())
+	value, _ = c.AutoValue([]byte("a"))
+	tt.Equal(t, 0, value)
+}
+
+func TestChangedSince(t *testing.T) {
+	c := New()
+	for i, key := range []string{"a", "ab", "abc", "b", "bc"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+	tt.Nil(t, c.InsertIn([]byte("c"), []int{1}))
+	tt.Nil(t, c.InsertIn([]byte("d"), "d"))
+
+	snap := c.Rebuild(8)
+	tt.Equal(t, 0, len(c.ChangedSince(snap)))
+
+	tt.Nil(t, c.Insert([]byte("ab"), 10))
+	tt.Nil(t, c.Update([]byte("bc"), 1))
+	tt.Nil(t, c.Insert([]byte("d"), 3))
+	tt.Nil(t, c.InsertIn([]byte("c"), []int{1}))
+	tt.Nil(t, c.Insert([]byte("e"), 0))
+	tt.Nil(t, c.Insert([]byte("de"), 0))
+	tt.Nil(t, c.Delete([]byte("a")))
+
+	var keys []string
+	for _, id := range c.ChangedSince(snap) {
+		key, err := c.Key(id)
+		tt.Nil(t, err)
+		keys = append(keys, string(key))
+	}
+	tt.Equal(t, []string{"ab", "bc", "d"}, keys)
+}
+
+func TestPin(t *testing.T) {
+	c := New()
+	for i, key := range []string{"a", "ab", "abc", "b"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+	tt.Nil(t, c.InsertIn([]byte("ac"), "ac"))
+
+	// a and ab with their terminal children, and the leaves abc and ac
+	tt.Equal(t, 6, c.Pin([]byte("a")))
+	tt.Equal(t, 1, c.Pin([]byte("abc")))
+	tt.Equal(t, 0, c.Pin([]byte("x")))
+	tt.True(t, c.Pin(nil) > c.Pin([]byte("a")))
+}
+
+func TestResolveStats(t *testing.T) {
+	c := New()
+	resolves, blocks := c.ResolveStats()
+	tt.Equal(t, 0, resolves)
+	tt.Equal(t, 0, blocks)
+
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+	resolves, blocks = c.ResolveStats()
+	tt.True(t, resolves > 0)
+	tt.True(t, blocks > 0)
+
+	_, _, size, _ := c.Status()
+	tt.True(t, blocks >= size>>8-1)
+}
+
+func TestCompactVals(t *testing.T) {
+	c := New()
+	for round := 0; round < 4; round++ {
+		for i, word := range words {
+			tt.Nil(t, c.InsertIn([]byte(word), i))
+		}
+		for _, word := range words[:len(words)/2] {
+			tt.Nil(t, c.Delete([]byte(word)))
+		}
+	}
+	tt.Nil(t, c.InsertIn([]byte("x"), "x"))
+	tt.Nil(t, c.InsertIn([]byte("x"), "y"))
+	tt.Equal(t, len(words)-len(words)/2+1, len(c.vals))
+
+	tt.Nil(t, c.CompactVals())
+	tt.Equal(t, len(c.vals), c.vkey)
+	for k := 1; k <= len(c.vals); k++ {
+		_, ok := c.vals[k]
+		tt.True(t, ok)
+	}
+
+	valueIn := func(key string) interface{} {
+		id, err := c.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		value, err := c.ValueIn(id)
+		tt.Nil(t, err)
+		return value
+	}
+	for i, word := range words[len(words)/2:] {
+		tt.Equal(t, len(words)/2+i, valueIn(word))
+	}
+	tt.Equal(t, "y", valueIn("x"))
+	tt.Nil(t, c.checkInvariants())
+}
+
+func TestInsertWith(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.InsertWith([]byte("cafe"), 1, []byte("Café")))
+	tt.Nil(t, c.InsertWith([]byte("cafes"), 2, []byte("Cafés")))
+	tt.Nil(t, c.Insert([]byte("ca"), 3))
+	tt.Equal(t, ErrInvalidKey, c.InsertWith([]byte("a\x00"), 1, nil))
+
+	display := func(key string) (string, bool) {
+		id, err := c.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		b, ok := c.Display(id)
+		return string(b), ok
+	}
+
+	d, ok := display("cafe")
+	tt.True(t, ok)
+	tt.Equal(t, "Café", d)
+	id, _ := c.Jump([]byte("cafe"), 0)
+	key, _ := c.Key(id)
+	tt.Equal(t, "cafe", string(key))
+
+	_, ok = display("ca")
+	tt.False(t, ok)
+	_, ok = display("caf")
+	tt.False(t, ok)
+
+	tt.Nil(t, c.Delete([]byte("cafes")))
+	tt.Nil(t, c.Insert([]byte("cafes"), 2))
+	_, ok = display("cafes")
+	tt.False(t, ok)
+
+	// the ids change, but not the display forms
+	tt.Nil(t, c.Compact())
+	d, _ = display("cafe")
+	tt.Equal(t, "Café", d)
+}
+
+func TestOnGrow(t *testing.T) {
+	c := New()
+	var grows [][2]int
+	c.OnGrow(func(oldCap, newCap int) {
+		grows = append(grows, [2]int{oldCap, newCap})
+	})
+
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+	tt.True(t, len(grows) > 0)
+	tt.Equal(t, 256, grows[0][0])
+	for i, g := range grows {
+		tt.Equal(t, 2*g[0], g[1])
+		if i > 0 {
+			tt.Equal(t, grows[i-1][1], g[0])
+		}
+	}
+	tt.Equal(t, grows[len(grows)-1][1], c.ArrayCapacity())
+	tt.Equal(t, c.Size, c.ArraySize())
+	tt.True(t, c.ArraySize() <= c.ArrayCapacity())
+
+	c.OnGrow(nil)
+	n := len(grows)
+	for i := 0; i < 1000; i++ {
+		tt.Nil(t, c.Insert([]byte(fmt.Sprint(i)), i))
+	}
+	tt.Equal(t, n, len(grows))
+}
+
+func TestDiff(t *testing.T) {
+	old := New()
+	for i, key := range []string{"a", "ab", "abc", "b", "bc", "c"} {
+		tt.Nil(t, old.Insert([]byte(key), i))
+	}
+	tt.Nil(t, old.InsertIn([]byte("in"), "in"))
+
+	c := old.Rebuild(4)
+	tt.Nil(t, c.Delete([]byte("ab")))
+	tt.Nil(t, c.Delete([]byte("c")))
+	tt.Nil(t, c.Insert([]byte("abcd"), 6))
+	tt.Nil(t, c.Insert([]byte("0"), 7))
+	tt.Nil(t, c.Update([]byte("bc"), 10))
+	tt.Nil(t, c.Insert([]byte("a"), 0))
+	tt.Nil(t, c.InsertIn([]byte("in"), "out"))
+
+	added, removed, changed := c.Diff(old)
+	tt.Equal(t, []string{"0", "abcd"}, toStrings(added))
+	tt.Equal(t, []string{"ab", "c"}, toStrings(removed))
+	tt.Equal(t, []KeyChange{{Key: []byte("bc"), OldValue: 4, NewValue: 14}}, changed)
+
+	added, removed, changed = old.Diff(old)
+	tt.Equal(t, 0, len(added)+len(removed)+len(changed))
+
+	added, removed, _ = New().Diff(old)
+	tt.Equal(t, 0, len(added))
+	tt.Equal(t, 6, len(removed))
+}
+
+func TestPredictFrom(t *testing.T) {
+	c := New()
+	c.Ordered = false
+	for i, key := range []string{"abd", "abc", "ab", "b"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	keys := func(ids []int) (keys []string) {
+		for _, id := range ids {
+			key, err := c.Key(id)
+			tt.Nil(t, err)
+			keys = append(keys, string(key))
+		}
+		return
+	}
+
+	id, consumed, ok := c.JumpNode([]byte("ab"), 0)
+	tt.True(t, ok)
+	tt.Equal(t, 2, consumed)
+	all := keys(c.PredictFrom(id, 0))
+	tt.Equal(t, 3, len(all))
+	tt.Equal(t, "ab", all[0])
+	tt.Equal(t, []string{"ab"}, keys(c.PredictFrom(id, 1)))
+	tt.Equal(t, all[:2], keys(c.PredictFrom(id, 2)))
+
+	id, _ = c.Step(0, 'a')
+	tt.Equal(t, 3, len(c.PredictFrom(id, 0)))
+	id, _ = c.Jump([]byte("abc"), 0)
+	tt.Equal(t, []string{"abc"}, keys(c.PredictFrom(id, 0)))
+	tt.Equal(t, 4, len(c.PredictFrom(0, 0)))
+	tt.Equal(t, 0, len(c.PredictFrom(c.Size, 0)))
+}
+
+// countingAllocator counts the nodes allocated.
+type countingAllocator struct {
+	nodes int
+}
+
+func (a *countingAllocator) AllocNodes(n int) []Node {
+	a.nodes += n
+	return make([]Node, n)
+}
+
+func (a *countingAllocator) AllocNInfos(n int) []NInfo {
+	return make([]NInfo, n)
+}
+
+func (a *countingAllocator) AllocBlocks(n int) []Block {
+	return make([]Block, n)
+}
+
+func TestAllocator(t *testing.T) {
+	a := &countingAllocator{}
+	c := New(WithAllocator(a))
+	tt.Equal(t, 256, a.nodes)
+
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+	tt.Equal(t, 2*c.Capacity-256, a.nodes)
+	for i, word := range words {
+		value, err := c.Get([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+
+	n := a.nodes
+	tt.Nil(t, c.Compact())
+	tt.True(t, a.nodes > n)
+	tt.Nil(t, c.checkInvariants())
+
+	n = a.nodes
+	tt.Nil(t, c.Clear())
+	tt.Equal(t, n+256, a.nodes)
+
+	var buf bytes.Buffer
+	_, err := cd.WriteTo(&buf)
+	tt.Nil(t, err)
+	b, err := cd.Bytes("gob")
+	tt.Nil(t, err)
+
+	n = a.nodes
+	_, err = c.ReadFrom(&buf)
+	tt.Nil(t, err)
+	tt.Equal(t, n+cd.Capacity, a.nodes)
+
+	n = a.nodes
+	tt.Nil(t, c.Load(bytes.NewReader(b), "gob"))
+	tt.Equal(t, n+cd.Capacity, a.nodes)
+	tt.Nil(t, c.checkInvariants())
+}
+
+func TestMembership(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("ab"), 1))
+	tt.Nil(t, c.InsertIn([]byte("abcd"), "abcd"))
+
+	for _, test := range []struct {
+		key                           string
+		contains, hasPrefix, prefixOf bool
+	}{
+		{"a", false, false, true},
+		{"ab", true, true, true},
+		{"abc", false, true, true},
+		{"abcd", true, true, false},
+		{"abx", false, true, false},
+		{"b", false, false, false},
+		{"ab\x00", false, true, false},
+	} {
+		key := []byte(test.key)
+		tt.Equal(t, test.contains, c.Contains(key), test.key)
+		tt.Equal(t, test.hasPrefix, c.HasPrefix(key), test.key)
+		tt.Equal(t, test.prefixOf, c.IsPrefixOf(key), test.key)
+	}
+}
+
+func TestValueDecoder(t *testing.T) {
+	c := New(WithValueDecoder(func(value int) int { return value * 10 }),
+		WithValueIndex())
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Insert([]byte("ab"), 2))
+	tt.Nil(t, c.Update([]byte("ab"), 1))
+
+	value, err := c.Get([]byte("ab"))
+	tt.Nil(t, err)
+	tt.Equal(t, 30, value)
+	id, _ := c.Jump([]byte("a"), 0)
+	value, err = c.Value(id)
+	tt.Nil(t, err)
+	tt.Equal(t, 10, value)
+
+	values, found := c.LookupBatchMasked([][]byte{[]byte("a"), []byte("b")})
+	tt.Equal(t, []int{10, 0}, values)
+	tt.Equal(t, []bool{true, false}, found)
+
+	var all []int
+	c.ForEach(func(key []byte, value int) bool {
+		all = append(all, value)
+		return true
+	})
+	tt.Equal(t, []int{10, 30}, all)
+
+	// the index holds the stored values
+	tt.Equal(t, []string{"ab"}, toStrings(c.KeysForValue(3)))
+	_, err = c.Get([]byte("b"))
+	tt.Equal(t, ErrNoPath, err)
+}
+
+func TestEmptyPrefixFrom(t *testing.T) {
+	c := New()
+	for i, key := range []string{"x", "xa", "xb", "y", "ya"} {
+		tt.Nil(t, c.Insert([]byte(key), i+1))
+	}
+
+	// the empty prefix starts from the node `from`, not from the root
+	from, err := c.Jump([]byte("x"), 0)
+	tt.Nil(t, err)
+	to, err := c.Jump(nil, from)
+	tt.Nil(t, err)
+	tt.Equal(t, from, to)
+	to, err = c.Freeze().Jump(nil, from)
+	tt.Nil(t, err)
+	tt.Equal(t, from, to)
+
+	tt.True(t, c.IsPrefix(nil, from))
+	tt.Equal(t, c.Extensions([]byte("x"), 0), c.Extensions(nil, from))
+	tt.Equal(t, []string{"", "a", "b"}, toStrings(c.CompleteSuffixes(nil, from, 0)))
+	tt.Equal(t, 3, len(c.PrefixPredictOrdered(nil, from, func(a, b []byte) bool {
+		return string(a) > string(b)
+	})))
+	tt.Equal(t, 3, len(c.PrefixPredictRune("", from)))
+	tt.Equal(t, 3, c.PrefixCount(nil, from))
+	tt.Equal(t, 0.6, c.PrefixSelectivity(nil, from))
+	tt.Equal(t, 6, c.PrefixSum(nil, from))
+	tt.Equal(t, c.SubtreeNodeCount([]byte("x"), 0), c.SubtreeNodeCount(nil, from))
+	tt.Equal(t, 3, c.SubTrie(nil, from).NumKeys())
+
+	detached, n, err := c.DetachPrefix(nil, from, false)
+	tt.Nil(t, err)
+	tt.Equal(t, 3, n)
+	tt.Equal(t, 3, detached.NumKeys())
+	tt.Equal(t, 2, c.NumKeys())
+	tt.True(t, c.Contains([]byte("ya")))
+}
+
+func TestDetachPrefix(t *testing.T) {
+	build := func() *Cedar {
+		c := New()
+		for i, key := range []string{"a", "ns", "ns/a", "ns/b", "nsx", "z"} {
+			tt.Nil(t, c.Insert([]byte(key), i))
+		}
+		tt.Nil(t, c.InsertIn([]byte("ns/c"), "c"))
+		return c
+	}
+
+	keys := func(c *Cedar) (keys []string) {
+		c.walk(0, func(id int, key []byte) bool {
+			keys = append(keys, string(key))
+			return true
+		})
+		return
+	}
+
+	c := build()
+	d, n, err := c.DetachPrefix([]byte("ns/"), 0, true)
+	tt.Nil(t, err)
+	tt.Equal(t, 3, n)
+	tt.Equal(t, []string{"a", "b", "c"}, keys(d))
+	tt.Equal(t, []string{"a", "ns", "nsx", "z"}, keys(c))
+	tt.Equal(t, 4, c.NumKeys())
+	id, _ := d.Jump([]byte("c"), 0)
+	v, err := d.ValueIn(id)
+	tt.Nil(t, err)
+	tt.Equal(t, "c", v)
+	tt.Nil(t, c.checkInvariants())
+
+	c = build()
+	from, _ := c.Jump([]byte("n"), 0)
+	d, n, err = c.DetachPrefix([]byte("s"), from, false)
+	tt.Nil(t, err)
+	tt.Equal(t, 5, n)
+	tt.Equal(t, []string{"ns", "ns/a", "ns/b", "ns/c", "nsx"}, keys(d))
+	tt.Equal(t, []string{"a", "z"}, keys(c))
+
+	c = build()
+	d, n, err = c.DetachPrefix([]byte("ns"), 0, true)
+	tt.Nil(t, err)
+	tt.Equal(t, []string{"", "/a", "/b", "/c", "x"}, keys(d))
+	value, err := d.Get(nil)
+	tt.Nil(t, err)
+	tt.Equal(t, 1, value)
+
+	d, n, err = c.DetachPrefix([]byte("none"), 0, true)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, n)
+	tt.Equal(t, 0, d.NumKeys())
+
+	c.SetReadOnly(true)
+	_, _, err = c.DetachPrefix([]byte("a"), 0, true)
+	tt.Equal(t, ErrReadOnly, err)
+}
+
+func TestBuildStats(t *testing.T) {
+	var keys [][]byte
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i*7919%2000)))
+	}
+
+	ordered, err := BuildStats(keys, true, 1)
+	tt.Nil(t, err)
+	tt.Equal(t, 2000, ordered.Keys)
+	tt.True(t, ordered.Nodes <= ordered.Size)
+	tt.Equal(t, float64(ordered.Nodes)/float64(ordered.Size), ordered.LoadFactor)
+	tt.True(t, ordered.Relocations > 0)
+
+	unordered, err := BuildStats(keys, false, 1)
+	tt.Nil(t, err)
+	tt.Equal(t, ordered.Nodes, unordered.Nodes)
+
+	_, err = BuildStats([][]byte{[]byte("a\x00")}, true, 1)
+	tt.Equal(t, ErrInvalidKey, err)
+}
+
+func TestKeep(t *testing.T) {
+	da := New()
+	for i, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		tt.Nil(t, da.Insert([]byte(key), []int{5, 1, 9, 5, 3, 5}[i]))
+	}
+	tt.Nil(t, da.InsertIn([]byte("g"), "g"))
+
+	n, err := da.Keep(3)
+	tt.Nil(t, err)
+	tt.Equal(t, 4, n)
+	tt.Equal(t, 3, da.NumKeys())
+	tt.True(t, da.Contains([]byte("a")))
+	tt.True(t, da.Contains([]byte("c")))
+	tt.True(t, da.Contains([]byte("d")))
+	tt.Nil(t, da.checkInvariants())
+
+	n, err = da.Keep(5)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, n)
+
+	n, err = da.Keep(0)
+	tt.Nil(t, err)
+	tt.Equal(t, 3, n)
+	tt.Equal(t, 0, da.NumKeys())
+
+	tt.Nil(t, da.Insert([]byte("a"), 1))
+	tt.Nil(t, da.InsertIn([]byte("c"), "c"))
+	tt.Nil(t, da.InsertIn([]byte("b"), "b"))
+	n, err = da.Keep(2)
+	tt.Nil(t, err)
+	tt.Equal(t, 1, n)
+	tt.True(t, da.Contains([]byte("a")))
+	tt.True(t, da.Contains([]byte("b")))
+	tt.False(t, da.Contains([]byte("c")))
+
+	values := []int{4, 8, 1, 8, 3, 7, 2}
+	for k, want := range []int{8, 8, 7, 4, 3, 2, 1} {
+		tt.Equal(t, want, selectLargest(append([]int(nil), values...), k))
+	}
+}
+
+func TestColumns(t *testing.T) {
+	da := New()
+	keys, values := da.Columns()
+	tt.Equal(t, 0, len(keys))
+	tt.Equal(t, 0, len(values))
+
+	tt.Nil(t, da.Insert([]byte("b"), 2))
+	tt.Nil(t, da.Insert([]byte("a"), 1))
+	tt.Nil(t, da.Insert([]byte("ab"), 3))
+	tt.Nil(t, da.InsertIn([]byte("c"), "c"))
+
+	keys, values = da.Columns()
+	tt.Equal(t, [][]byte{[]byte("a"), []byte("ab"), []byte("b")}, keys)
+	tt.Equal(t, []int{1, 3, 2}, values)
+
+	da = New()
+	da.Ordered = false
+	for i, key := range []string{"b", "c", "a", "ab", "aa"} {
+		tt.Nil(t, da.Insert([]byte(key), i))
+	}
+
+	keys, values = da.Columns()
+	tt.Equal(t, []string{"a", "aa", "ab", "b", "c"}, toStrings(keys))
+	tt.Equal(t, []int{2, 4, 3, 0, 1}, values)
+}
+
+func TestDeepestCommonNode(t *testing.T) {
+	tt.Equal(t, 2, CommonPrefixLen([]byte("abc"), []byte("abd")))
+	tt.Equal(t, 0, CommonPrefixLen([]byte("abc"), []byte("x")))
+	tt.Equal(t, 2, CommonPrefixLen([]byte("ab"), []byte("abc")))
+
+	da := New()
+	for _, key := range []string{"abc", "abd", "ab", "x"} {
+		tt.Nil(t, da.Insert([]byte(key), 1))
+	}
+
+	ab, err := da.Jump([]byte("ab"), 0)
+	tt.Nil(t, err)
+	id, ok := da.DeepestCommonNode([]byte("abc"), []byte("abd"))
+	tt.True(t, ok)
+	tt.Equal(t, ab, id)
+
+	id, ok = da.DeepestCommonNode([]byte("ab"), []byte("abc"))
+	tt.True(t, ok)
+	tt.Equal(t, ab, id)
+
+	id, ok = da.DeepestCommonNode([]byte("abc"), []byte("x"))
+	tt.True(t, ok)
+	tt.Equal(t, 0, id)
+
+	_, ok = da.DeepestCommonNode([]byte("abc"), []byte("a"))
+	tt.False(t, ok)
+}
+
+func TestEmptyPrefixQueries(t *testing.T) {
+	da := New()
+	tt.Equal(t, 0, len(da.PrefixPredict(nil, 0)))
+	tt.Equal(t, 0, len(da.PrefixPredict([]byte("a"), 0)))
+	tt.Equal(t, 0, len(da.PrefixMatch(nil, 0)))
+	tt.Equal(t, 0, len(da.PrefixMatch([]byte("a"), 0)))
+	tt.Equal(t, 0, len(da.PrefixPredictSelf(nil, 0, true)))
+	tt.Equal(t, 0, len(da.Extensions(nil, 0)))
+
+	tt.Nil(t, da.Insert([]byte("ab"), 1))
+	tt.Equal(t, 0, len(da.PrefixPredict([]byte("x"), 0)))
+	tt.Equal(t, 0, len(da.PrefixMatch([]byte("x"), 0)))
+
+	tt.Nil(t, da.Delete([]byte("ab")))
+	tt.Equal(t, 0, len(da.PrefixPredict(nil, 0)))
+	tt.Equal(t, 0, len(da.PrefixMatch([]byte("ab"), 0)))
+
+	tt.Nil(t, da.Clear())
+	tt.Equal(t, 0, len(da.PrefixPredict(nil, 0)))
+}
+
+func TestValues(t *testing.T) {
+	da := New()
+	for i, key := range []string{"a", "ab", "abc"} {
+		tt.Nil(t, da.Insert([]byte(key), i+1))
+	}
+
+	values, err := da.Values(da.PrefixPredict([]byte("a"), 0))
+	tt.Nil(t, err)
+	tt.Equal(t, []int{1, 2, 3}, values)
+
+	values, err = da.Values(nil)
+	tt.Nil(t, err)
+	tt.Equal(t, 0, len(values))
+
+	tt.Nil(t, da.Insert([]byte("xyz"), 4))
+	id, err := da.Jump([]byte("x"), 0)
+	tt.Nil(t, err)
+	values, err = da.Values([]int{id})
+	tt.Equal(t, ErrNoValue, err)
+	tt.Equal(t, 0, len(values))
+}
+
+func TestCommonAncestor(t *testing.T) {
+	da := New()
+	tt.Nil(t, da.Insert([]byte("abcd"), 1))
+	tt.Nil(t, da.Insert([]byte("abx"), 2))
+
+	abc, err := da.Jump([]byte("abc"), 0)
+	tt.Nil(t, err)
+	id, depth := da.CommonAncestor([]byte("abcd"), []byte("abce"))
+	tt.Equal(t, abc, id)
+	tt.Equal(t, 3, depth)
+
+	ab, err := da.Jump([]byte("ab"), 0)
+	tt.Nil(t, err)
+	id, depth = da.CommonAncestor([]byte("abyz"), []byte("abyw"))
+	tt.Equal(t, ab, id)
+	tt.Equal(t, 2, depth)
+
+	id, depth = da.CommonAncestor([]byte("abcd"), []byte("xbcd"))
+	tt.Equal(t, 0, id)
+	tt.Equal(t, 0, depth)
+}
+
+func TestMultiPrefixPredict(t *testing.T) {
+	prefixes := [][]byte{[]byte("太阳系"), []byte("太阳"), []byte("ab"),
+		[]byte(""), []byte("太阳系"), []byte("太阳系水星"), []byte("太阳系冥王星")}
+	preds := cd.MultiPrefixPredict(prefixes)
+	tt.Equal(t, 6, len(preds))
+	for _, prefix := range prefixes {
+		tt.Equal(t, cd.PrefixPredict(prefix, 0), preds[string(prefix)])
+	}
+
+	tt.Equal(t, 0, len(New().MultiPrefixPredict(prefixes)[""]))
+	tt.Equal(t, 0, len(cd.MultiPrefixPredict(nil)))
+}
+
+func TestForEachMut(t *testing.T) {
+	da := New(WithValueIndex())
+	for i, key := range []string{"a", "ab", "b", "c"} {
+		tt.Nil(t, da.Insert([]byte(key), (i+1)*10))
+	}
+	tt.Nil(t, da.InsertIn([]byte("x"), "x"))
+
+	err := da.ForEachMut(func(key []byte, value *int) bool {
+		*value /= 2
+		return true
+	})
+	tt.Nil(t, err)
+	for i, key := range []string{"a", "ab", "b", "c"} {
+		v, err := da.Get([]byte(key))
+		tt.Nil(t, err)
+		tt.Equal(t, (i+1)*5, v)
+	}
+	tt.Equal(t, [][]byte{[]byte("b")}, da.KeysForValue(15))
+	tt.Equal(t, 0, len(da.KeysForValue(30)))
+
+	n := 0
+	err = da.ForEachMut(func(key []byte, value *int) bool {
+		n++
+		*value = -1
+		return true
+	})
+	tt.Equal(t, ErrInvalidValue, err)
+	tt.Equal(t, 1, n)
+	v, err := da.Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Equal(t, 5, v)
+
+	da.SetReadOnly(true)
+	tt.Equal(t, ErrReadOnly, da.ForEachMut(func([]byte, *int) bool { return true }))
+}
+
+func TestLookupFull(t *testing.T) {
+	da := New()
+	tt.Nil(t, da.Insert([]byte("ab"), 7))
+	tt.Nil(t, da.InsertInLen([]byte("abc"), "abc", 12))
+
+	value, length, found := da.LookupFull([]byte("ab"))
+	tt.True(t, found)
+	tt.Equal(t, 7, value)
+	tt.Equal(t, 2, length)
+
+	// the value of InsertIn is not an int
+	value, length, found = da.LookupFull([]byte("abc"))
+	tt.False(t, found)
+	tt.Equal(t, 0, value)
+	tt.Equal(t, 0, length)
+
+	for _, key := range []string{"a", "abcd", "x"} {
+		_, _, found = da.LookupFull([]byte(key))
+		tt.False(t, found)
+	}
+}
+
+func TestCoveringPrefixes(t *testing.T) {
+	da := New()
+	tt.Equal(t, 0, len(da.CoveringPrefixes(-1)))
+
+	for _, key := range []string{"apple", "apricot", "banana", "car", "cart", "cat"} {
+		tt.Nil(t, da.Insert([]byte(key), 1))
+	}
+
+	tt.Equal(t, []string{"app", "apr", "b", "car", "cat"}, toStrings(da.CoveringPrefixes(-1)))
+	tt.Equal(t, []string{"ap", "b", "ca"}, toStrings(da.CoveringPrefixes(2)))
+	tt.Equal(t, []string{""}, toStrings(da.CoveringPrefixes(0)))
+
+	tt.Nil(t, da.Insert([]byte(""), 1))
+	tt.Equal(t, []string{""}, toStrings(da.CoveringPrefixes(-1)))
+}
+
+func TestInsertFunc(t *testing.T) {
+	pieces := func(parts ...string) func() (byte, bool) {
+		key := []byte(strings.Join(parts, "/"))
+		return func() (byte, bool) {
+			if len(key) == 0 {
+				return 0, false
+			}
+			b := key[0]
+			key = key[1:]
+			return b, true
+		}
+	}
+
+	da := New()
+	tt.Nil(t, da.InsertFunc(pieces("usr", "local", "bin"), 1))
+	tt.Nil(t, da.InsertFunc(pieces("usr", "lib"), 2))
+	v, err := da.Get([]byte("usr/local/bin"))
+	tt.Nil(t, err)
+	tt.Equal(t, 1, v)
+	tt.Equal(t, ErrInvalidKey, da.InsertFunc(pieces("a\x00b"), 3))
+	_, err = da.Jump([]byte("a"), 0)
+	tt.Equal(t, ErrNoPath, err)
+	tt.Equal(t, 2, da.NumKeys())
+	tt.Nil(t, da.checkInvariants())
+
+	c := New(WithMaxKeyLen(4), WithInsertOrder())
+	tt.Equal(t, ErrKeyTooLong{Len: 7, Max: 4}, c.InsertFunc(pieces("usr", "lib"), 1))
+	tt.Nil(t, c.InsertFunc(pieces("usr"), 1))
+	tt.Nil(t, c.InsertFunc(pieces("us"), 2))
+	var order []string
+	c.ForEachInserted(func(key []byte, id int) bool {
+		order = append(order, string(key))
+		return true
+	})
+	tt.Equal(t, []string{"usr", "us"}, order)
+	tt.Nil(t, c.checkInvariants())
+
+	v, err = da.LookupFunc(pieces("usr", "lib"))
+	tt.Nil(t, err)
+	tt.Equal(t, 2, v)
+	_, err = da.LookupFunc(pieces("usr"))
+	tt.Equal(t, ErrNoValue, err)
+	_, err = da.LookupFunc(pieces("usr", "share"))
+	tt.Equal(t, ErrNoPath, err)
+	_, err = da.LookupFunc(pieces("usr", "lib\x00"))
+	tt.Equal(t, ErrNoPath, err)
+}
+
+func TestIsValid(t *testing.T) {
+	da := New()
+	tt.Nil(t, da.Insert([]byte("ab"), 1))
+	tt.Nil(t, da.Insert([]byte("abc"), 2))
+	tt.Nil(t, da.InsertIn([]byte("x"), "x"))
+
+	for _, key := range []string{"ab", "abc", "x"} {
+		id, err := da.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		tt.True(t, da.IsValid(id))
+	}
+
+	a, err := da.Jump([]byte("a"), 0)
+	tt.Nil(t, err)
+	tt.False(t, da.IsValid(a))
+
+	abc, err := da.Jump([]byte("abc"), 0)
+	tt.Nil(t, err)
+	tt.Nil(t, da.Delete([]byte("abc")))
+	tt.False(t, da.IsValid(abc))
+
+	for _, id := range []int{-1, da.Size, da.Capacity + 10} {
+		tt.False(t, da.IsValid(id))
+		_, err := da.Key(id)
+		tt.Equal(t, ErrNoPath, err)
+		_, err = da.Value(id)
+		tt.Equal(t, ErrNoValue, err)
+		_, err = da.ValueIn(id)
+		tt.Equal(t, ErrNoValue, err)
+		_, err = da.ValueLen(id)
+		tt.Equal(t, ErrNoValue, err)
+	}
+}
+
+func TestPredictAny(t *testing.T) {
+	da := New()
+	for i, key := range []string{"a", "ab", "abc", "b", "ba", "c", "ca"} {
+		tt.Nil(t, da.Insert([]byte(key), i))
+	}
+
+	keys := func(ids []int) (s []string) {
+		for _, id := range ids {
+			key, err := da.Key(id)
+			tt.Nil(t, err)
+			s = append(s, string(key))
+		}
+		return
+	}
+
+	prefixes := [][]byte{[]byte("c"), []byte("ab"), []byte("x"), []byte("a"), []byte("ab")}
+	tt.Equal(t, []string{"a", "ab", "abc", "c", "ca"}, keys(da.PredictAny(prefixes, 0)))
+	tt.Equal(t, []string{"a", "ab", "abc", "c"}, keys(da.PredictAny(prefixes, 4)))
+	tt.Equal(t, []string{"a", "ab"}, keys(da.PredictAny(prefixes, 2)))
+	tt.Equal(t, 7, len(da.PredictAny([][]byte{[]byte("b"), []byte("")}, 0)))
+	tt.Equal(t, 0, len(da.PredictAny(nil, 0)))
+}
+
+func TestNodeIDRange(t *testing.T) {
+	da := New()
+	min, max := da.NodeIDRange()
+	tt.Equal(t, 0, min)
+	tt.Equal(t, 0, max)
+
+	var ids []int
+	for _, key := range []string{"ab", "abc", "x", "太阳"} {
+		tt.Nil(t, da.Insert([]byte(key), 1))
+		for i := 1; i <= len(key); i++ {
+			id, err := da.Jump([]byte(key)[:i], 0)
+			tt.Nil(t, err)
+			ids = append(ids, id)
+		}
+	}
+
+	min, max = da.NodeIDRange()
+	for _, id := range ids {
+		tt.True(t, min <= id && id <= max)
+	}
+	tt.True(t, max < da.ArraySize())
+	tt.True(t, da.Array[min].Check >= 0)
+	tt.True(t, da.Array[max].Check >= 0)
+}
+
+func TestValueBytes(t *testing.T) {
+	da := New()
+	tt.Nil(t, da.Insert([]byte("a"), 1))
+	tt.Equal(t, 0, da.ValueBytes())
+
+	tt.Nil(t, da.InsertIn([]byte("b"), "hello"))
+	tt.Nil(t, da.InsertIn([]byte("c"), []byte("abc")))
+	tt.Nil(t, da.InsertIn([]byte("d"), int64(1)))
+	tt.Nil(t, da.InsertIn([]byte("e"), true))
+	tt.Nil(t, da.InsertIn([]byte("f"), nil))
+	tt.Equal(t, 5+3+8+1, da.ValueBytes())
+
+	tt.Nil(t, da.Delete([]byte("b")))
+	tt.Equal(t, 3+8+1, da.ValueBytes())
+}
+
+func TestPrefixSum(t *testing.T) {
+	da := New()
+	for i, key := range []string{"ns/a", "ns/b", "ns/b/c", "other"} {
+		tt.Nil(t, da.Insert([]byte(key), i+1))
+	}
+	tt.Nil(t, da.InsertIn([]byte("ns/x"), "x"))
+
+	tt.Equal(t, 1+2+3, da.PrefixSum([]byte("ns/"), 0))
+	tt.Equal(t, 2+3, da.PrefixSum([]byte("ns/b"), 0))
+	tt.Equal(t, 10, da.PrefixSum(nil, 0))
+	tt.Equal(t, 0, da.PrefixSum([]byte("none"), 0))
+
+	ns, err := da.Jump([]byte("ns/"), 0)
+	tt.Nil(t, err)
+	tt.Equal(t, 2+3, da.PrefixSum([]byte("b"), ns))
+}
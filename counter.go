@@ -0,0 +1,62 @@
+package cedar
+
+import "sync"
+
+// ConcurrentCounter counts the occurrences of keys from many goroutines.
+// A cedar can not be modified concurrently, so the counter keeps
+// 256 independent cedars, one per first byte of the keys, each with
+// its own lock, and the goroutines only contend on the keys starting
+// with the same byte. Finalize merges them into a single cedar.
+type ConcurrentCounter struct {
+	shards [256]counterShard
+}
+
+type counterShard struct {
+	mu sync.Mutex
+	da *Cedar
+}
+
+// NewConcurrentCounter new ConcurrentCounter
+func NewConcurrentCounter() *ConcurrentCounter {
+	return &ConcurrentCounter{}
+}
+
+// Increment adds delta to the count of the key, like Cedar.Update.
+// It is safe for concurrent use.
+func (c *ConcurrentCounter) Increment(key []byte, delta int) error {
+	var s *counterShard
+	if len(key) > 0 {
+		s = &c.shards[key[0]]
+	} else {
+		s = &c.shards[0]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.da == nil {
+		s.da = New()
+	}
+
+	return s.da.Update(key, delta)
+}
+
+// Finalize returns a new cedar holding the counts of all the keys.
+// The keys of the shards are disjoint, and they are inserted in order.
+// The counter is left untouched, and it can go on counting.
+func (c *ConcurrentCounter) Finalize() *Cedar {
+	da := New()
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		if s.da != nil {
+			s.da.ForEach(func(key []byte, value int) bool {
+				da.Insert(key, value)
+				return true
+			})
+		}
+		s.mu.Unlock()
+	}
+
+	return da
+}
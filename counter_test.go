@@ -0,0 +1,39 @@
+package cedar
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestConcurrentCounter(t *testing.T) {
+	c := NewConcurrentCounter()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, word := range words {
+				tt.Nil(t, c.Increment([]byte(word), 1))
+			}
+		}()
+	}
+	wg.Wait()
+	tt.Equal(t, ErrInvalidKey, c.Increment([]byte("a\x00"), 1))
+
+	da := c.Finalize()
+	tt.Equal(t, len(words), da.NumKeys())
+	for _, word := range words {
+		value, err := da.Get([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, 8, value)
+	}
+	tt.Nil(t, da.checkInvariants())
+
+	tt.Nil(t, c.Increment([]byte("a"), 2))
+	value, err := c.Finalize().Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Equal(t, 10, value)
+}
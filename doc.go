@@ -8,7 +8,8 @@
 //
 // Note
 //
-// key must be `[]byte` without zero items,
+// key must be `[]byte` without zero items (see EscapeKey for binary keys,
+// or WithTerminator to end the keys with another byte),
 // while value must be integer in the range [0, 2<<63-2] or
 // [0, 2<<31-2] depends on the platform.
 //
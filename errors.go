@@ -2,6 +2,7 @@ package cedar
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -11,9 +12,40 @@ var (
 	ErrInvalidValue = errors.New("cedar: invalid value")
 	// ErrInvalidKey invalid key error
 	ErrInvalidKey = errors.New("cedar: invalid key")
+	// ErrReadOnly read-only cedar error
+	ErrReadOnly = errors.New("cedar: read-only")
+	// ErrNotSorted not sorted key error
+	ErrNotSorted = errors.New("cedar: key not sorted")
+	// ErrCapacityExceeded capacity exceeded error
+	ErrCapacityExceeded = errors.New("cedar: capacity exceeded")
+	// ErrCorrupt corrupt data error
+	ErrCorrupt = errors.New("cedar: corrupt data")
 
 	// ErrNoPath no path error
 	ErrNoPath = errors.New("cedar: no path")
 	// ErrNoValue no value error
 	ErrNoValue = errors.New("cedar: no value")
 )
+
+// ErrUnsupportedVersion is returned when loading a cedar saved in
+// a newer format version `Have` than the version `Want` supported.
+type ErrUnsupportedVersion struct {
+	Have int
+	Want int
+}
+
+func (e ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("cedar: unsupported format version %d, want %d or older",
+		e.Have, e.Want)
+}
+
+// ErrKeyTooLong is returned when inserting a key of `Len` bytes,
+// longer than the maximum `Max` set by WithMaxKeyLen.
+type ErrKeyTooLong struct {
+	Len int
+	Max int
+}
+
+func (e ErrKeyTooLong) Error() string {
+	return fmt.Sprintf("cedar: key of %d bytes longer than %d", e.Len, e.Max)
+}
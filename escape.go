@@ -0,0 +1,134 @@
+package cedar
+
+import "bytes"
+
+// The label 0 of a node is its terminal which holds the value,
+// so a key can not contain a zero byte, unless another terminator is
+// chosen with WithTerminator. Otherwise binary keys are escaped as
+//
+//	0x00 -> 0x01 0x01
+//	0x01 -> 0x01 0x02
+//
+// which keeps the byte order and the prefixes of the keys,
+// so the ordered traversal and the prefix search still work
+// on the escaped keys.
+const (
+	escapeByte = 0x01
+)
+
+// validKey returns ErrInvalidKey, if the key contains the terminator.
+func validKey(key []byte, term byte) error {
+	if bytes.IndexByte(key, term) >= 0 {
+		return ErrInvalidKey
+	}
+
+	return nil
+}
+
+// WithMaxKeyLen makes the insertions of the keys longer than `n` bytes
+// return ErrKeyTooLong, as a guard against garbage keys, e.g. a whole
+// file read as one key. The keys are unlimited by default.
+func WithMaxKeyLen(n int) Option {
+	return func(da *Cedar) {
+		da.maxKeyLen = n
+	}
+}
+
+// checkKey checks a key to be inserted, see validKey and WithMaxKeyLen.
+func (da *Cedar) checkKey(key []byte) error {
+	if da.maxKeyLen > 0 && len(key) > da.maxKeyLen {
+		return ErrKeyTooLong{Len: len(key), Max: da.maxKeyLen}
+	}
+
+	return validKey(key, da.term)
+}
+
+// WithTerminator makes the byte `term` end the keys instead of the zero
+// byte, for a key space known never to contain `term`, e.g. 0xff for
+// UTF-8 text: the keys may then contain zero bytes, and the keys
+// containing `term` are invalid instead. The keys keep their byte order.
+// The terminator is not saved, so a saved cedar must be loaded into
+// a cedar with the same terminator.
+func WithTerminator(term byte) Option {
+	return func(da *Cedar) {
+		da.term = term
+	}
+}
+
+// label returns the label of the byte `b` of a key, see termLabel.
+func (da *Cedar) label(b byte) byte {
+	return termLabel(b, da.term)
+}
+
+// char returns the byte of a key of the label `l`, other than 0.
+func (da *Cedar) char(l byte) byte {
+	return termChar(l, da.term)
+}
+
+// termLabel returns the label of the byte `b` of a key with the
+// terminator `term`. The bytes below the terminator are shifted up
+// by one, which leaves the label 0 to the terminal and keeps the order
+// of the bytes.
+func termLabel(b, term byte) byte {
+	if b < term {
+		return b + 1
+	}
+
+	return b
+}
+
+// termChar is the inverse of termLabel, for the labels other than 0.
+func termChar(l, term byte) byte {
+	if l <= term {
+		return l - 1
+	}
+
+	return l
+}
+
+// EscapeKey returns the binary key with the zero bytes escaped,
+// which can be inserted into the cedar.
+func EscapeKey(key []byte) []byte {
+	n := bytes.Count(key, []byte{0}) + bytes.Count(key, []byte{escapeByte})
+	if n == 0 {
+		return key
+	}
+
+	escaped := make([]byte, 0, len(key)+n)
+	for _, c := range key {
+		if c <= escapeByte {
+			escaped = append(escaped, escapeByte, c+1)
+			continue
+		}
+		escaped = append(escaped, c)
+	}
+
+	return escaped
+}
+
+// UnescapeKey returns the binary key of the key escaped by EscapeKey.
+// It will return ErrInvalidKey, if the key is not a valid escaped key.
+func UnescapeKey(key []byte) ([]byte, error) {
+	if bytes.IndexByte(key, 0) >= 0 {
+		return nil, ErrInvalidKey
+	}
+
+	if bytes.IndexByte(key, escapeByte) < 0 {
+		return key, nil
+	}
+
+	unescaped := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == escapeByte {
+			i++
+			if i == len(key) || key[i] > escapeByte+1 {
+				return nil, ErrInvalidKey
+			}
+			c = key[i] - 1
+		}
+		unescaped = append(unescaped, c)
+	}
+
+	return unescaped, nil
+}
@@ -0,0 +1,124 @@
+package cedar
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestInvalidKey(t *testing.T) {
+	c := New()
+	tt.Equal(t, ErrInvalidKey, c.Insert([]byte("a\x00b"), 1))
+	tt.Equal(t, ErrInvalidKey, c.InsertIn([]byte("\x00"), 1))
+	tt.Equal(t, ErrInvalidKey, c.Update([]byte("ab\x00"), 1))
+
+	keys, _, _, _ := c.Status()
+	tt.Equal(t, 0, keys)
+}
+
+func TestMaxKeyLen(t *testing.T) {
+	c := New(WithMaxKeyLen(4))
+	tt.Nil(t, c.Insert([]byte("abcd"), 1))
+
+	long := []byte("abcde")
+	err := ErrKeyTooLong{Len: 5, Max: 4}
+	tt.Equal(t, err, c.Insert(long, 1))
+	tt.Equal(t, err, c.InsertIn(long, 1))
+	tt.Equal(t, err, c.Update(long, 1))
+	_, autoErr := c.AutoValue(long)
+	tt.Equal(t, err, autoErr)
+	tt.Equal(t, "cedar: key of 5 bytes longer than 4", err.Error())
+	tt.Equal(t, 1, c.NumKeys())
+
+	tt.Nil(t, New().Insert(bytes.Repeat(long, 100), 1))
+}
+
+func TestTerminator(t *testing.T) {
+	c := New(WithTerminator(0xff))
+	keys := [][]byte{{0}, {0, 0}, {0, 1}, {1}, {1, 0}, {0xfe}, []byte("a\x00b")}
+	for i, key := range keys {
+		tt.Nil(t, c.Insert(key, i))
+	}
+	tt.Equal(t, ErrInvalidKey, c.Insert([]byte("a\xffb"), 1))
+	tt.Equal(t, ErrInvalidKey, New().Insert([]byte{0}, 1))
+
+	for i, key := range keys {
+		v, err := c.Get(key)
+		tt.Nil(t, err)
+		tt.Equal(t, i, v)
+	}
+	tt.False(t, c.Contains([]byte{0xff}))
+
+	sorted := append([][]byte(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	var got [][]byte
+	for _, id := range c.PrefixPredict(nil, 0) {
+		key, err := c.Key(id)
+		tt.Nil(t, err)
+		got = append(got, key)
+	}
+	tt.Equal(t, sorted, got)
+	tt.Equal(t, sorted[1:3], c.KeysAfter(sorted[0], 2))
+
+	f := c.Freeze()
+	for i, key := range keys {
+		v, err := f.Get(key)
+		tt.Nil(t, err)
+		tt.Equal(t, i, v)
+
+		id, err := f.Jump(key, 0)
+		tt.Nil(t, err)
+		fkey, err := f.Key(id)
+		tt.Nil(t, err)
+		tt.Equal(t, key, fkey)
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	keys := [][]byte{
+		{}, {0}, {0, 0}, {0, 1}, {1}, {1, 0}, {1, 2}, {2},
+		[]byte("a"), []byte("a\x00"), []byte("a\x00b"), []byte("a\x01"),
+		[]byte("ab"), {0xff, 0},
+	}
+
+	c := New()
+	for i, key := range keys {
+		escaped := EscapeKey(key)
+		tt.Equal(t, -1, bytes.IndexByte(escaped, 0))
+
+		unescaped, err := UnescapeKey(escaped)
+		tt.Nil(t, err)
+		tt.True(t, bytes.Equal(key, unescaped))
+
+		if len(key) > 0 {
+			tt.Nil(t, c.Insert(escaped, i))
+		}
+	}
+
+	sorted := make([][]byte, 0, len(keys))
+	for _, id := range c.PrefixPredict(nil, 0) {
+		key, err := c.Key(id)
+		tt.Nil(t, err)
+
+		key, err = UnescapeKey(key)
+		tt.Nil(t, err)
+		sorted = append(sorted, key)
+	}
+
+	tt.True(t, sort.SliceIsSorted(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	}))
+	tt.Equal(t, len(keys)-1, len(sorted))
+
+	ids := c.PrefixMatch(EscapeKey([]byte("a\x00b")), 0)
+	tt.Equal(t, 3, len(ids))
+
+	for _, key := range []string{"\x00", "\x01", "\x01\x03", "a\x01"} {
+		_, err := UnescapeKey([]byte(key))
+		tt.Equal(t, ErrInvalidKey, err)
+	}
+}
@@ -0,0 +1,65 @@
+package cedar
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// CaseFoldCollisions returns the groups of the keys which are equal
+// under Unicode case folding, as with strings.EqualFold, e.g. "Go",
+// "GO" and "go", as the value node ids of each group, so that the keys
+// merged by folding them can be checked beforehand. The groups are in
+// the order of their first keys, and the keys alone are left out.
+func (da *Cedar) CaseFoldCollisions() (groups [][]int) {
+	index := make(map[string]int)
+	var ids [][]int
+	da.walk(0, func(id int, key []byte) bool {
+		folded := string(foldKey(key))
+		i, ok := index[folded]
+		if !ok {
+			i = len(ids)
+			index[folded] = i
+			ids = append(ids, nil)
+		}
+
+		ids[i] = append(ids[i], id)
+		return true
+	})
+
+	for _, group := range ids {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	return
+}
+
+// foldKey returns the key with each character replaced by the smallest
+// character it folds to, so that the keys equal under case folding have
+// the same folded key. The invalid UTF-8 bytes are kept as they are.
+func foldKey(key []byte) []byte {
+	folded := make([]byte, 0, len(key))
+	for len(key) > 0 {
+		r, size := utf8.DecodeRune(key)
+		if r == utf8.RuneError && size == 1 {
+			folded = append(folded, key[0])
+			key = key[1:]
+			continue
+		}
+
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+
+		var buf [utf8.UTFMax]byte
+		n := utf8.EncodeRune(buf[:], min)
+		folded = append(folded, buf[:n]...)
+		key = key[size:]
+	}
+
+	return folded
+}
@@ -0,0 +1,31 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestCaseFoldCollisions(t *testing.T) {
+	c := New()
+	for i, key := range []string{"Go", "GO", "go", "gopher", "Straße",
+		"STRASSE", "Kelvin", "Kelvin", "Σίσυφος", "ΣΊΣΥΦΟΣ", "\xffa", "\xffA"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	var groups [][]string
+	for _, group := range c.CaseFoldCollisions() {
+		var keys []string
+		for _, id := range group {
+			key, err := c.Key(id)
+			tt.Nil(t, err)
+			keys = append(keys, string(key))
+		}
+		groups = append(groups, keys)
+	}
+
+	// the full folding of ß to ss is not a simple folding
+	tt.Equal(t, [][]string{{"GO", "Go", "go"}, {"Kelvin", "Kelvin"},
+		{"ΣΊΣΥΦΟΣ", "Σίσυφος"}, {"\xffA", "\xffa"}}, groups)
+	tt.Equal(t, 0, len(New().CaseFoldCollisions()))
+}
@@ -0,0 +1,280 @@
+package cedar
+
+import "io"
+
+// FrozenCedar is a read-only copy of a cedar, made by Freeze.
+// It only keeps the base and check of the nodes up to the last one
+// in use, without the free lists and sibling links needed to modify
+// the trie, and the values added by InsertIn in a flat array,
+// so it is smaller than the Cedar it was made from.
+//
+// A FrozenCedar can not be modified. Save it with Save,
+// and load it with LoadFrozen. The values added by InsertIn
+// are saved as they are, so with gob their concrete types must
+// be registered with gob.Register, except for the basic types,
+// and with json they are loaded as the json types.
+type FrozenCedar struct {
+	Array  []node        // the base and check of the nodes
+	Ends   []uint64      // the bitset of the nodes holding a value in Values
+	Values []interface{} // the values added by InsertIn
+
+	Terminator byte // the byte which ends the keys, see WithTerminator
+}
+
+// Freeze returns a FrozenCedar holding all the keys of the cedar.
+// The cedar itself is left untouched.
+func (da *Cedar) Freeze() *FrozenCedar {
+	last := 0
+	for i := da.Size - 1; i > 0; i-- {
+		if da.Array[i].Check >= 0 {
+			last = i
+			break
+		}
+	}
+
+	f := &FrozenCedar{
+		Array: make([]node, last+1),
+		Ends:  make([]uint64, last/64+1),
+
+		Terminator: da.term,
+	}
+
+	for i, n := range da.Array[:last+1] {
+		if n.Check < 0 {
+			f.Array[i] = node{Value: 0, Check: -1}
+			continue
+		}
+
+		if n.Value >= 0 && da.Ninfos[i].End {
+			f.Ends[i/64] |= 1 << uint(i%64)
+			f.Values = append(f.Values, da.vals[n.Value].Value)
+			n.Value = len(f.Values) - 1
+		}
+		f.Array[i] = n
+	}
+
+	return f
+}
+
+// Jump travels from a node `from` to another node
+// `to` by following the path `path`, like Cedar.Jump.
+func (f *FrozenCedar) Jump(path []byte, from int) (to int, err error) {
+	to = from
+	for _, b := range path {
+		if b == f.Terminator || f.Array[from].Value >= 0 {
+			return from, ErrNoPath
+		}
+
+		to = f.Array[from].base() ^ int(termLabel(b, f.Terminator))
+		if to >= len(f.Array) || f.Array[to].Check != from || to == 0 {
+			return from, ErrNoPath
+		}
+		from = to
+	}
+
+	return to, nil
+}
+
+// Key returns the key of the node with the given `id`.
+// It will return ErrNoPath, if the node does not exist.
+func (f *FrozenCedar) Key(id int) (key []byte, err error) {
+	for id > 0 {
+		from := f.Array[id].Check
+		if from < 0 {
+			return nil, ErrNoPath
+		}
+
+		if label := byte(f.Array[from].base() ^ id); label != 0 {
+			key = append(key, termChar(label, f.Terminator))
+		}
+		id = from
+	}
+
+	if id != 0 || len(key) == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	for i := 0; i < len(key)/2; i++ {
+		key[i], key[len(key)-i-1] = key[len(key)-i-1], key[i]
+	}
+
+	return key, nil
+}
+
+// valueNode returns the node which holds the value of the node `id`,
+// it is either `id` itself or its terminal child.
+func (f *FrozenCedar) valueNode(id int) (int, bool) {
+	if f.Array[id].Value >= 0 {
+		return id, true
+	}
+
+	to := f.Array[id].base()
+	if to < len(f.Array) && f.Array[to].Check == id && f.Array[to].Value >= 0 {
+		return to, true
+	}
+
+	return 0, false
+}
+
+func (f *FrozenCedar) end(id int) bool {
+	return f.Ends[id/64]&(1<<uint(id%64)) != 0
+}
+
+// Value returns the value added by Insert of the node with the given `id`.
+// It will return ErrNoValue, if the node does not have such a value.
+func (f *FrozenCedar) Value(id int) (value int, err error) {
+	to, ok := f.valueNode(id)
+	if !ok || f.end(to) {
+		return 0, ErrNoValue
+	}
+
+	return f.Array[to].Value, nil
+}
+
+// ValueIn returns the value added by InsertIn of the node with the given `id`.
+// It will return ErrNoValue, if the node does not have such a value.
+func (f *FrozenCedar) ValueIn(id int) (value interface{}, err error) {
+	to, ok := f.valueNode(id)
+	if !ok || !f.end(to) {
+		return nil, ErrNoValue
+	}
+
+	return f.Values[f.Array[to].Value], nil
+}
+
+// Get returns the value added by Insert of the key.
+func (f *FrozenCedar) Get(key []byte) (value int, err error) {
+	to, err := f.Jump(key, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return f.Value(to)
+}
+
+// PrefixMatch returns a list of at most `num` nodes which match
+// the prefix of the key, like Cedar.PrefixMatch.
+func (f *FrozenCedar) PrefixMatch(key []byte, num int) (ids []int) {
+	for from, i := 0, 0; i < len(key); i++ {
+		to, err := f.Jump(key[i:i+1], from)
+		if err != nil {
+			break
+		}
+
+		if _, ok := f.valueNode(to); ok {
+			ids = append(ids, to)
+			num--
+			if num == 0 {
+				return
+			}
+		}
+
+		from = to
+	}
+
+	return
+}
+
+// BuildMPH returns a minimal perfect hash of the keys of the FrozenCedar:
+// a function which maps each of its N keys to a distinct index in
+// 0..N-1, their rank in byte order, and reports whether the key is
+// in the FrozenCedar at all. It keeps a rank per node, not the keys,
+// in a slice as long as the Array of the FrozenCedar.
+// It will return ErrInvalidDataType, if a value of the FrozenCedar
+// is missing, e.g. if it was loaded from corrupted data.
+func (f *FrozenCedar) BuildMPH() (func(key []byte) (int, bool), error) {
+	ranks := make([]int32, len(f.Array))
+	for i := range ranks {
+		ranks[i] = -1
+	}
+
+	var (
+		n     int32
+		visit func(from int) error
+	)
+	visit = func(from int) error {
+		base := f.Array[from].base()
+		for label := 0; label < 256; label++ {
+			to := base ^ label
+			if to == 0 || to >= len(f.Array) || f.Array[to].Check != from {
+				continue
+			}
+
+			if f.Array[to].Value < 0 {
+				if err := visit(to); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if f.end(to) && f.Array[to].Value >= len(f.Values) {
+				return ErrInvalidDataType
+			}
+			ranks[to] = n
+			n++
+		}
+
+		return nil
+	}
+
+	if len(f.Array) > 0 {
+		if err := visit(0); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(key []byte) (int, bool) {
+		if validKey(key, f.Terminator) != nil {
+			return 0, false
+		}
+
+		to, err := f.Jump(key, 0)
+		if err != nil {
+			return 0, false
+		}
+
+		if to, ok := f.valueNode(to); ok {
+			if rank := ranks[to]; rank >= 0 {
+				return int(rank), true
+			}
+		}
+
+		return 0, false
+	}, nil
+}
+
+// Save saves the FrozenCedar to an io.Writer,
+// where dataType is either "json" or "gob".
+func (f *FrozenCedar) Save(out io.Writer, dataType string) error {
+	enc, err := newEncoder(out, dataType)
+	if err != nil {
+		return err
+	}
+
+	if err := writeHeader(out); err != nil {
+		return err
+	}
+
+	return enc.Encode(f)
+}
+
+// LoadFrozen loads a FrozenCedar saved by FrozenCedar.Save from
+// an io.Reader, where dataType is either "json" or "gob".
+func LoadFrozen(in io.Reader, dataType string) (*FrozenCedar, error) {
+	in, err := readHeader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newDecoder(in, dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FrozenCedar{}
+	if err := dec.Decode(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
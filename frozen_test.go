@@ -0,0 +1,110 @@
+package cedar
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestFreeze(t *testing.T) {
+	f := cd.Freeze()
+	tt.True(t, len(f.Array) <= len(cd.Array))
+
+	for i, word := range words {
+		value, err := f.Get([]byte(word))
+		if i%4 == 0 {
+			tt.NotNil(t, err)
+			continue
+		}
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+
+		id, err := f.Jump([]byte(word), 0)
+		tt.Nil(t, err)
+		key, err := f.Key(id)
+		tt.Nil(t, err)
+		tt.Equal(t, word, string(key))
+	}
+
+	_, err := f.Get([]byte("not found"))
+	tt.Equal(t, ErrNoPath, err)
+	_, err = f.Get([]byte("太阳"))
+	tt.Equal(t, ErrNoValue, err)
+
+	for _, key := range []string{"abcdefg", "新星联邦共和国", "this is a sentence."} {
+		tt.Equal(t, cd.PrefixMatch([]byte(key), 0), f.PrefixMatch([]byte(key), 0))
+	}
+
+	for _, dataType := range []string{"gob", "json"} {
+		var buf bytes.Buffer
+		tt.Nil(t, f.Save(&buf, dataType))
+
+		lf, err := LoadFrozen(&buf, dataType)
+		tt.Nil(t, err)
+		value, err := lf.Get([]byte("abcdefghijklmn"))
+		tt.Nil(t, err)
+		tt.Equal(t, 11, value)
+	}
+}
+
+func TestFreezeValueIn(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.InsertIn([]byte("ab"), "x"))
+	tt.Nil(t, c.InsertIn([]byte("abc"), "y"))
+	tt.Nil(t, c.Insert([]byte("b"), 3))
+
+	f := c.Freeze()
+	var buf bytes.Buffer
+	tt.Nil(t, f.Save(&buf, "gob"))
+	f, err := LoadFrozen(&buf, "gob")
+	tt.Nil(t, err)
+
+	for key, v := range map[string]string{"ab": "x", "abc": "y"} {
+		id, err := f.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+		value, err := f.ValueIn(id)
+		tt.Nil(t, err)
+		tt.Equal(t, v, value)
+
+		_, err = f.Value(id)
+		tt.Equal(t, ErrNoValue, err)
+	}
+
+	value, err := f.Get([]byte("b"))
+	tt.Nil(t, err)
+	tt.Equal(t, 3, value)
+
+	id, err := f.Jump([]byte("b"), 0)
+	tt.Nil(t, err)
+	_, err = f.ValueIn(id)
+	tt.Equal(t, ErrNoValue, err)
+}
+
+func TestBuildMPH(t *testing.T) {
+	f := cd.Freeze()
+	mph, err := f.BuildMPH()
+	tt.Nil(t, err)
+
+	var n int
+	seen := make(map[int]bool)
+	cd.ForEach(func(key []byte, value int) bool {
+		rank, ok := mph(key)
+		tt.True(t, ok)
+		tt.Equal(t, n, rank)
+		seen[rank] = true
+		n++
+		return true
+	})
+	tt.Equal(t, n, len(seen))
+
+	for _, key := range []string{"", "太阳", "not found", "abcdefg\x00", words[0]} {
+		_, ok := mph([]byte(key))
+		tt.False(t, ok)
+	}
+
+	empty, err := New().Freeze().BuildMPH()
+	tt.Nil(t, err)
+	_, ok := empty([]byte("a"))
+	tt.False(t, ok)
+}
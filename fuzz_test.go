@@ -0,0 +1,12 @@
+//go:build go1.18
+// +build go1.18
+
+package cedar
+
+import "testing"
+
+func FuzzOps(f *testing.F) {
+	f.Add([]byte{0, 0, 1, 0, 1, 2, 2, 0, 0})
+	f.Add([]byte{0, 9, 1, 0, 10, 2, 2, 9, 0, 1, 14, 3})
+	f.Fuzz(applyOps)
+}
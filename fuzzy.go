@@ -0,0 +1,109 @@
+package cedar
+
+// SubstitutionCosts provides the edit costs used by FuzzyMatchWeighted.
+// Insert is the cost of a byte present in the stored key but not in the query,
+// Delete is the cost of a byte present in the query but not in the stored key,
+// and Substitute is the cost of replacing the query byte `a` by `b`.
+type SubstitutionCosts interface {
+	Insert(b byte) float64
+	Delete(b byte) float64
+	Substitute(a, b byte) float64
+}
+
+// UnitCosts charges 1 for every insertion, deletion and substitution,
+// which gives the plain Levenshtein distance.
+type UnitCosts struct{}
+
+// Insert returns the cost of inserting `b`.
+func (UnitCosts) Insert(b byte) float64 { return 1 }
+
+// Delete returns the cost of deleting `b`.
+func (UnitCosts) Delete(b byte) float64 { return 1 }
+
+// Substitute returns the cost of replacing `a` by `b`.
+func (UnitCosts) Substitute(a, b byte) float64 { return 1 }
+
+// FuzzyMatch returns the nodes of all keys within the
+// Levenshtein distance `maxDist` (in bytes) of the key.
+// These nodes are ordered by their keys.
+func (da *Cedar) FuzzyMatch(key []byte, maxDist int) []int {
+	return da.FuzzyMatchWeighted(key, float64(maxDist), UnitCosts{})
+}
+
+// FuzzyMatchWeighted returns the nodes of all keys which can be turned
+// into the key at a total cost of at most `maxCost`, using `costs`
+// to price each edit. Equal bytes never cost anything.
+// If `costs` is nil, UnitCosts is used.
+// These nodes are ordered by their keys.
+func (da *Cedar) FuzzyMatchWeighted(key []byte, maxCost float64,
+	costs SubstitutionCosts) (ids []int) {
+	if costs == nil {
+		costs = UnitCosts{}
+	}
+
+	// row[j] is the cost between the path walked so far and key[:j]
+	row := make([]float64, len(key)+1)
+	for j := 1; j <= len(key); j++ {
+		row[j] = row[j-1] + costs.Delete(key[j-1])
+	}
+
+	fz := fuzzy{da: da, key: key, maxCost: maxCost, costs: costs}
+	fz.walk(0, row)
+
+	return fz.ids
+}
+
+type fuzzy struct {
+	da      *Cedar
+	key     []byte
+	maxCost float64
+	costs   SubstitutionCosts
+	ids     []int
+}
+
+func (fz *fuzzy) walk(from int, row []float64) {
+	if row[len(fz.key)] <= fz.maxCost {
+		if id, ok := fz.da.valueNode(from); ok {
+			fz.ids = append(fz.ids, id)
+		}
+	}
+
+	fz.da.eachChild(from, func(label byte, to int) bool {
+		if label == 0 {
+			return true
+		}
+		label = fz.da.char(label)
+
+		next := make([]float64, len(row))
+		next[0] = row[0] + fz.costs.Insert(label)
+		min := next[0]
+		for j := 1; j < len(row); j++ {
+			sub := row[j-1]
+			if fz.key[j-1] != label {
+				sub += fz.costs.Substitute(fz.key[j-1], label)
+			}
+
+			next[j] = minCost(sub, row[j]+fz.costs.Insert(label),
+				next[j-1]+fz.costs.Delete(fz.key[j-1]))
+			if next[j] < min {
+				min = next[j]
+			}
+		}
+
+		if min <= fz.maxCost {
+			fz.walk(to, next)
+		}
+		return true
+	})
+}
+
+func minCost(a, b, c float64) float64 {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		return c
+	}
+	return a
+}
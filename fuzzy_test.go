@@ -0,0 +1,46 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+type ocrCosts struct {
+	UnitCosts
+}
+
+func (ocrCosts) Substitute(a, b byte) float64 {
+	if a == '0' && b == 'O' || a == 'O' && b == '0' {
+		return 0.1
+	}
+
+	return 1
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	c := New()
+	for i, word := range []string{"abc", "abd", "abcd", "xbc", "b", "bc", "BOOK"} {
+		err := c.Insert([]byte(word), i)
+		tt.Nil(t, err)
+	}
+
+	ids := c.FuzzyMatch([]byte("abc"), 0)
+	check(c, ids, []string{"abc"}, []int{0})
+
+	ids = c.FuzzyMatch([]byte("abc"), 1)
+	check(c, ids, []string{"abc", "abcd", "abd", "bc", "xbc"},
+		[]int{0, 2, 1, 5, 3})
+
+	ids = c.FuzzyMatch([]byte("a"), 1)
+	check(c, ids, []string{"b"}, []int{4})
+
+	ids = c.FuzzyMatch([]byte("B00K"), 1)
+	tt.Equal(t, 0, len(ids))
+
+	ids = c.FuzzyMatchWeighted([]byte("B00K"), 0.5, ocrCosts{})
+	check(c, ids, []string{"BOOK"}, []int{6})
+
+	ids = c.FuzzyMatchWeighted([]byte("abc"), 1, nil)
+	tt.Equal(t, 5, len(ids))
+}
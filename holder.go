@@ -0,0 +1,59 @@
+package cedar
+
+import "sync/atomic"
+
+// Holder holds the live cedar of a read-mostly server, which is
+// rebuilt in the background and swapped in atomically: the readers
+// Load the current cedar, and the writer builds a new one and Stores it.
+// The reads in flight finish against the old cedar, which is never
+// modified again, so no lock and no copy of the cedar is needed.
+//
+// The cedar held must not be modified after it is stored, and it must
+// not use EnablePrefixCache or WithAccessTracking, as they update it
+// on reads. The ids of a cedar are only valid for it, so a reader
+// resolving ids, e.g. from PrefixPredict, should Load the cedar once.
+type Holder struct {
+	v atomic.Value
+}
+
+// NewHolder new Holder holding the cedar
+func NewHolder(da *Cedar) *Holder {
+	h := &Holder{}
+	h.Store(da)
+	return h
+}
+
+// Load returns the cedar held. It is safe for concurrent use.
+func (h *Holder) Load() *Cedar {
+	return h.v.Load().(*Cedar)
+}
+
+// Store replaces the cedar held. It is safe for concurrent use.
+func (h *Holder) Store(da *Cedar) {
+	h.v.Store(da)
+}
+
+// SwapIn replaces the cedar held, and returns the old one, which can
+// still be in use by the readers which loaded it. The load and the store
+// are not one atomic step, so the cedars should be swapped in by a single
+// writer.
+func (h *Holder) SwapIn(da *Cedar) (old *Cedar) {
+	old = h.Load()
+	h.Store(da)
+	return
+}
+
+// Get returns the value of the key in the cedar held, see Cedar.Get.
+func (h *Holder) Get(key []byte) (int, error) {
+	return h.Load().Get(key)
+}
+
+// Contains reports whether the cedar held has the key.
+func (h *Holder) Contains(key []byte) bool {
+	return h.Load().Contains(key)
+}
+
+// NumKeys returns the number of the keys in the cedar held.
+func (h *Holder) NumKeys() int {
+	return h.Load().NumKeys()
+}
@@ -0,0 +1,44 @@
+package cedar
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestHolder(t *testing.T) {
+	old := New()
+	tt.Nil(t, old.Insert([]byte("a"), 1))
+	h := NewHolder(old)
+	tt.True(t, h.Contains([]byte("a")))
+	tt.Equal(t, 1, h.NumKeys())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				da := h.Load()
+				v, err := da.Get([]byte("a"))
+				tt.Nil(t, err)
+				if v == 2 {
+					tt.True(t, da.Contains([]byte("b")))
+				}
+			}
+		}()
+	}
+
+	da := New()
+	tt.Nil(t, da.Insert([]byte("a"), 2))
+	tt.Nil(t, da.Insert([]byte("b"), 3))
+	tt.Equal(t, old, h.SwapIn(da))
+	wg.Wait()
+
+	v, err := h.Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Equal(t, 2, v)
+	tt.Equal(t, 2, h.NumKeys())
+	tt.Equal(t, 1, old.NumKeys())
+}
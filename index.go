@@ -0,0 +1,81 @@
+package cedar
+
+import (
+	"bytes"
+	"sort"
+)
+
+// WithValueIndex makes the cedar keep an index from each value added
+// by Insert or Update to its keys, for KeysForValue and DeleteByValue.
+// The index holds a copy of every key, and each insertion, update
+// and deletion also updates it.
+func WithValueIndex() Option {
+	return func(da *Cedar) {
+		da.index = make(map[int]map[string]struct{})
+	}
+}
+
+// indexAdd adds the key of the value to the index, if any.
+func (da *Cedar) indexAdd(key []byte, value int) {
+	if da.index == nil {
+		return
+	}
+
+	keys := da.index[value]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		da.index[value] = keys
+	}
+	keys[string(key)] = struct{}{}
+}
+
+// indexRemove removes the key of the value from the index, if any.
+func (da *Cedar) indexRemove(key []byte, value int) {
+	if da.index == nil {
+		return
+	}
+
+	keys := da.index[value]
+	delete(keys, string(key))
+	if len(keys) == 0 {
+		delete(da.index, value)
+	}
+}
+
+// indexRebuild rebuilds the index from the keys, if any.
+func (da *Cedar) indexRebuild() {
+	if da.index == nil {
+		return
+	}
+
+	da.index = make(map[int]map[string]struct{})
+	da.forEach(func(key []byte, value int) bool {
+		da.indexAdd(key, value)
+		return true
+	})
+}
+
+// KeysForValue returns the keys added by Insert or Update
+// with the value, in ascending order. With WithValueIndex it only
+// costs the copy of the keys, otherwise it walks the whole cedar.
+func (da *Cedar) KeysForValue(value int) (keys [][]byte) {
+	if da.index == nil {
+		da.forEach(func(key []byte, v int) bool {
+			if v == value {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+			return true
+		})
+
+		return
+	}
+
+	for key := range da.index[value] {
+		keys = append(keys, []byte(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	return
+}
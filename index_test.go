@@ -0,0 +1,51 @@
+package cedar
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func toStrings(keys [][]byte) (s []string) {
+	for _, key := range keys {
+		s = append(s, string(key))
+	}
+	return
+}
+
+func TestKeysForValue(t *testing.T) {
+	for _, c := range []*Cedar{New(), New(WithValueIndex())} {
+		tt.Nil(t, c.Insert([]byte("b"), 1))
+		tt.Nil(t, c.Insert([]byte("a"), 1))
+		tt.Nil(t, c.Insert([]byte("ab"), 2))
+		tt.Nil(t, c.Update([]byte("abc"), 1))
+		tt.Equal(t, []string{"a", "abc", "b"}, toStrings(c.KeysForValue(1)))
+
+		tt.Nil(t, c.Update([]byte("abc"), 1))
+		tt.Nil(t, c.Insert([]byte("a"), 3))
+		tt.Nil(t, c.InsertIn([]byte("b"), 1))
+		tt.Equal(t, 0, len(c.KeysForValue(1)))
+		tt.Equal(t, []string{"ab", "abc"}, toStrings(c.KeysForValue(2)))
+
+		tt.Nil(t, c.Delete([]byte("ab")))
+		tt.Equal(t, []string{"abc"}, toStrings(c.KeysForValue(2)))
+
+		n, err := c.DeleteByValue(2)
+		tt.Nil(t, err)
+		tt.Equal(t, 1, n)
+		tt.Equal(t, []string{"a"}, toStrings(c.KeysForValue(3)))
+
+		sub := c.SubTrie([]byte("a"), 0)
+		tt.Equal(t, []string{""}, toStrings(sub.KeysForValue(3)))
+
+		b, err := c.Bytes("gob")
+		tt.Nil(t, err)
+		l := New(WithValueIndex())
+		tt.Nil(t, l.Load(bytes.NewReader(b), "gob"))
+		tt.Equal(t, []string{"a"}, toStrings(l.KeysForValue(3)))
+
+		tt.Nil(t, c.Clear())
+		tt.Equal(t, 0, len(c.KeysForValue(3)))
+	}
+}
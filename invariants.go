@@ -0,0 +1,209 @@
+package cedar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkInvariants checks the structure of the cedar: the parent of
+// every node, the sibling chains, the values and the free lists
+// of the blocks. It returns an error describing the first broken
+// invariant, it costs O(size).
+func (da *Cedar) checkInvariants() error {
+	if da.Size > da.Capacity || len(da.Array) < da.Capacity ||
+		len(da.Ninfos) < da.Capacity || len(da.Blocks) < da.Size>>8 {
+		return fmt.Errorf("cedar: size %d does not fit capacity %d",
+			da.Size, da.Capacity)
+	}
+
+	children := make([]int, da.Size)
+	for i := 1; i < da.Size; i++ {
+		n := da.Array[i]
+		if n.Check < 0 {
+			continue
+		}
+
+		from := n.Check
+		if from >= da.Size || (from != 0 && da.Array[from].Check < 0) {
+			return fmt.Errorf("cedar: node %d has an invalid parent %d", i, from)
+		}
+
+		if da.Array[from].Value >= 0 || da.Array[from].base()^i > 255 {
+			return fmt.Errorf("cedar: node %d is not a child of %d", i, from)
+		}
+		children[from]++
+
+		if n.Value == ValueLimit {
+			return fmt.Errorf("cedar: node %d has no value", i)
+		}
+
+		if n.Value >= 0 && da.Ninfos[i].End {
+			if _, ok := da.vals[n.Value]; !ok {
+				return fmt.Errorf("cedar: node %d has a missing value %d", i, n.Value)
+			}
+		}
+	}
+
+	for i, count := range children {
+		if count == 0 {
+			// only the root is an inner node without children
+			if i != 0 && da.Array[i].Check >= 0 && da.Array[i].Value < 0 {
+				return fmt.Errorf("cedar: inner node %d has no children", i)
+			}
+			continue
+		}
+
+		base := da.Array[i].base()
+		n, prev := 0, -1
+		for c := int(da.Ninfos[i].Child); ; {
+			to := base ^ c
+			if to >= da.Size || da.Array[to].Check != i {
+				return fmt.Errorf("cedar: broken sibling chain of node %d", i)
+			}
+
+			if da.Ordered && c <= prev {
+				return fmt.Errorf("cedar: unordered sibling chain of node %d", i)
+			}
+
+			n++
+			if n > count {
+				return fmt.Errorf("cedar: looping sibling chain of node %d", i)
+			}
+
+			prev, c = c, int(da.Ninfos[to].Sibling)
+			if c == 0 {
+				break
+			}
+		}
+
+		if n != count {
+			return fmt.Errorf("cedar: node %d has %d children, %d in its chain",
+				i, count, n)
+		}
+	}
+
+	for bi := 0; bi < da.Size>>8; bi++ {
+		b := da.Blocks[bi]
+		free := 0
+		for i := bi << 8; i < (bi+1)<<8; i++ {
+			if da.Array[i].Check < 0 {
+				free++
+			}
+		}
+
+		num := b.Num
+		if bi == 0 {
+			// the root is counted as free in Num
+			num--
+		}
+
+		if free != num {
+			return fmt.Errorf("cedar: block %d has %d free nodes, %d in Num",
+				bi, free, num)
+		}
+
+		if free == 0 {
+			continue
+		}
+
+		n := 0
+		for e := b.Ehead; ; {
+			if e>>8 != bi || da.Array[e].Check >= 0 {
+				return fmt.Errorf("cedar: node %d in the free list of block %d",
+					e, bi)
+			}
+
+			next := -da.Array[e].Check
+			if da.Array[next].Value != -e {
+				return fmt.Errorf("cedar: broken free list of block %d", bi)
+			}
+
+			n++
+			if n > free {
+				return fmt.Errorf("cedar: looping free list of block %d", bi)
+			}
+
+			if e = next; e == b.Ehead {
+				break
+			}
+		}
+
+		if n != free {
+			return fmt.Errorf("cedar: block %d has %d free nodes, %d in its list",
+				bi, free, n)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the structure of the cedar, see VerifyFile.
+// It returns an error wrapping ErrCorrupt, which describes the first
+// broken invariant. It costs O(size).
+func (da *Cedar) Validate() error {
+	if err := da.checkInvariants(); err != nil {
+		return corrupt(err)
+	}
+
+	return nil
+}
+
+// RebuildFreeList repairs the free lists of a cedar whose nodes in use
+// are intact, e.g. loaded from a file whose free lists are suspect:
+// every node with a negative check is taken as free, and the cyclic
+// free list, the number of free nodes and the heuristics of each block
+// are rebuilt from scratch, then the lists of blocks and the global
+// heuristics. Validate should pass afterwards, unless the nodes in use
+// are broken too.
+func (da *Cedar) RebuildFreeList() error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	for bi := 0; bi < da.Size>>8; bi++ {
+		var free []int
+		for e := bi << 8; e < (bi+1)<<8; e++ {
+			if da.Array[e].Check < 0 {
+				free = append(free, e)
+			}
+		}
+
+		b := &da.Blocks[bi]
+		b.Num, b.Reject, b.Trial = len(free), 257, 0
+		if bi == 0 {
+			// the root is counted as free in Num
+			b.Num++
+		}
+
+		for i, e := range free {
+			prev := free[(i+len(free)-1)%len(free)]
+			next := free[(i+1)%len(free)]
+			da.Array[e] = node{-prev, -next}
+			da.Ninfos[e] = ninfo{}
+		}
+
+		if len(free) > 0 {
+			b.Ehead = free[0]
+		}
+	}
+
+	for i := range da.Reject {
+		da.Reject[i] = i + 1
+	}
+
+	da.relinkBlocks()
+	return nil
+}
+
+// corrupt wraps a broken invariant in ErrCorrupt.
+func corrupt(err error) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt,
+		strings.TrimPrefix(err.Error(), "cedar: "))
+}
+
+// assertInvariants panics, if an invariant of the cedar is broken.
+func (da *Cedar) assertInvariants() {
+	if err := da.checkInvariants(); err != nil {
+		panic(err)
+	}
+}
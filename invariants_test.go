@@ -0,0 +1,58 @@
+package cedar
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestRebuildFreeList(t *testing.T) {
+	da := New()
+	for i, word := range words {
+		tt.Nil(t, da.Insert([]byte(word), i))
+	}
+	for i := 0; i < 2000; i++ {
+		tt.Nil(t, da.Insert([]byte(fmt.Sprintf("key%d", i)), i))
+	}
+	for i := 0; i < 2000; i += 3 {
+		tt.Nil(t, da.Delete([]byte(fmt.Sprintf("key%d", i))))
+	}
+	tt.Nil(t, da.Validate())
+
+	// break the free lists, but not the nodes in use
+	for bi := range da.Blocks {
+		b := &da.Blocks[bi]
+		b.Num, b.Ehead, b.Reject, b.Trial = 3, bi<<8, 1, 7
+	}
+	da.BheadF, da.BheadC, da.BheadO = 0, 0, 0
+	err := da.Validate()
+	tt.True(t, errors.Is(err, ErrCorrupt))
+
+	tt.Nil(t, da.RebuildFreeList())
+	tt.Nil(t, da.Validate())
+
+	for i := 2000; i < 4000; i++ {
+		tt.Nil(t, da.Insert([]byte(fmt.Sprintf("key%d", i)), i))
+	}
+	tt.Nil(t, da.Validate())
+	for i := 0; i < 4000; i++ {
+		v, err := da.Get([]byte(fmt.Sprintf("key%d", i)))
+		if i < 2000 && i%3 == 0 {
+			tt.NotNil(t, err)
+			continue
+		}
+		tt.Nil(t, err)
+		tt.Equal(t, i, v)
+	}
+
+	c := New()
+	tt.Nil(t, c.RebuildFreeList())
+	tt.Nil(t, c.Validate())
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Validate())
+
+	da.SetReadOnly(true)
+	tt.Equal(t, ErrReadOnly, da.RebuildFreeList())
+}
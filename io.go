@@ -2,26 +2,167 @@ package cedar
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
+	"sort"
 
 	"encoding/gob"
 	"encoding/json"
 )
 
-// Save saves the cedar to an io.Writer,
-// where dataType is either "json" or "gob".
-func (da *Cedar) Save(out io.Writer, dataType string) error {
+type encoder interface {
+	Encode(v interface{}) error
+}
+
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+func newEncoder(out io.Writer, dataType string) (encoder, error) {
+	switch dataType {
+	case "gob", "GOB":
+		return gob.NewEncoder(out), nil
+	case "json", "JSON":
+		return json.NewEncoder(out), nil
+	}
+
+	return nil, ErrInvalidDataType
+}
+
+func newDecoder(in io.Reader, dataType string) (decoder, error) {
 	switch dataType {
 	case "gob", "GOB":
-		dataEecoder := gob.NewEncoder(out)
-		return dataEecoder.Encode(da)
+		return gob.NewDecoder(in), nil
 	case "json", "JSON":
-		dataEecoder := json.NewEncoder(out)
-		return dataEecoder.Encode(da)
+		return json.NewDecoder(in), nil
+	}
+
+	return nil, ErrInvalidDataType
+}
+
+// The saved cedars start with a header of a magic and the format version.
+// Its first byte is 0, which neither a gob nor a json stream starts with,
+// so the cedars saved without the header are still loaded.
+const formatVersion = 1
+
+var magic = []byte{0, 'c', 'd', 'r'}
+
+func writeHeader(out io.Writer) error {
+	_, err := out.Write(append(magic[:len(magic):len(magic)], formatVersion))
+	return err
+}
+
+// readHeader reads the header, if any, and returns the reader
+// of the rest of the stream.
+func readHeader(in io.Reader) (io.Reader, error) {
+	r := bufio.NewReader(in)
+	if b, err := r.Peek(1); err != nil || b[0] != 0 {
+		return r, nil
+	}
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return nil, ErrInvalidDataType
+	}
+
+	if version := int(header[len(magic)]); version > formatVersion {
+		return nil, ErrUnsupportedVersion{Have: version, Want: formatVersion}
+	}
+
+	return r, nil
+}
+
+// ValueCodec encodes and decodes the values added by InsertIn,
+// when they are saved with SaveWithCodec and loaded with LoadWithCodec.
+type ValueCodec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// GobCodec is the default ValueCodec, it encodes the values with gob,
+// so their concrete types must be registered with gob.Register,
+// except for the basic types.
+type GobCodec struct{}
+
+// Encode encodes the value with gob.
+func (GobCodec) Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the value with gob.
+func (GobCodec) Decode(data []byte) (value interface{}, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return
+}
+
+// encodedValue is the saved form of a value added by InsertIn.
+type encodedValue struct {
+	Key  int
+	Len  int
+	Data []byte
+}
+
+// Save saves the cedar to an io.Writer,
+// where dataType is either "json" or "gob".
+// The values added by InsertIn are not saved, use SaveWithCodec for them.
+func (da *Cedar) Save(out io.Writer, dataType string) error {
+	enc, err := newEncoder(out, dataType)
+	if err != nil {
+		return err
+	}
+
+	if err := writeHeader(out); err != nil {
+		return err
 	}
 
-	return ErrInvalidDataType
+	return enc.Encode(da)
+}
+
+// SaveWithCodec saves the cedar to an io.Writer like Save, followed by
+// the values added by InsertIn encoded with `codec` (GobCodec if nil).
+// It must be loaded with LoadWithCodec.
+func (da *Cedar) SaveWithCodec(out io.Writer, dataType string,
+	codec ValueCodec) error {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+
+	enc, err := newEncoder(out, dataType)
+	if err != nil {
+		return err
+	}
+
+	if err := writeHeader(out); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(da); err != nil {
+		return err
+	}
+
+	values := make([]encodedValue, 0, len(da.vals))
+	for k, v := range da.vals {
+		data, err := codec.Encode(v.Value)
+		if err != nil {
+			return err
+		}
+		values = append(values, encodedValue{k, v.Len, data})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
+	})
+
+	return enc.Encode(values)
 }
 
 // SaveToFile saves the cedar to a file,
@@ -40,17 +181,134 @@ func (da *Cedar) SaveToFile(fileName, dataType string) error {
 
 // Load loads the cedar from an io.Writer,
 // where dataType is either "json" or "gob".
+// The values added by InsertIn are not loaded, use LoadWithCodec for them.
 func (da *Cedar) Load(in io.Reader, dataType string) error {
-	switch dataType {
-	case "gob", "GOB":
-		dataDecoder := gob.NewDecoder(in)
-		return dataDecoder.Decode(da)
-	case "json", "JSON":
-		dataDecoder := json.NewDecoder(in)
-		return dataDecoder.Decode(da)
+	if err := da.writable(); err != nil {
+		return err
 	}
 
-	return ErrInvalidDataType
+	n, err := read(in, dataType, false, nil)
+	if err != nil {
+		return err
+	}
+
+	return da.loadFrom(n)
+}
+
+// LoadWithCodec loads the cedar saved by SaveWithCodec from an io.Reader,
+// decoding the values added by InsertIn with `codec` (GobCodec if nil).
+func (da *Cedar) LoadWithCodec(in io.Reader, dataType string,
+	codec ValueCodec) error {
+	if err := da.writable(); err != nil {
+		return err
+	}
+
+	if codec == nil {
+		codec = GobCodec{}
+	}
+
+	n, err := read(in, dataType, true, codec)
+	if err != nil {
+		return err
+	}
+
+	return da.loadFrom(n)
+}
+
+// read reads a cedar saved by Save or SaveWithCodec from an io.Reader:
+// the header, the trie and, if `values`, the values added by InsertIn
+// which follow it, decoded with `codec`. If codec is nil, the values
+// are optional, and only their keys and lengths are read. The keys of
+// the values which are not read are reserved, see reserveVals.
+// It decodes into a zero cedar, as gob leaves the zero fields
+// of the stream untouched.
+func read(in io.Reader, dataType string, values bool,
+	codec ValueCodec) (*Cedar, error) {
+	in, err := readHeader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newDecoder(in, dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	var n Cedar
+	if err := dec.Decode(&n); err != nil {
+		return nil, err
+	}
+	n.vals = make(map[int]nvalue)
+
+	if values {
+		var saved []encodedValue
+		if err := dec.Decode(&saved); err != nil && (codec != nil || err != io.EOF) {
+			return nil, err
+		}
+
+		for _, v := range saved {
+			var value interface{}
+			if codec != nil {
+				if value, err = codec.Decode(v.Data); err != nil {
+					return nil, err
+				}
+			}
+			n.vals[v.Key] = nvalue{Len: v.Len, Value: value}
+		}
+	}
+	n.reserveVals()
+
+	return &n, nil
+}
+
+// loadFrom replaces the keys of the cedar with those of `n` read by read,
+// keeping the settings of the cedar but Ordered and MaxTrial.
+func (da *Cedar) loadFrom(n *Cedar) error {
+	da.cache.clear()
+	da.setStorage(n)
+	da.Ordered, da.MaxTrial = n.Ordered, n.MaxTrial
+	da.restored()
+
+	return da.loaded()
+}
+
+// reserveVals adds an empty value for each node of a value added by
+// InsertIn whose value was not loaded, e.g. saved by Save, so that
+// the keys of the values are never reused by the next InsertIn,
+// and moves vkey past the largest key of the values.
+func (da *Cedar) reserveVals() {
+	for i := 0; i < da.Size && i < len(da.Array) && i < len(da.Ninfos); i++ {
+		n := da.Array[i]
+		if n.Check < 0 || n.Value < 0 || !da.Ninfos[i].End {
+			continue
+		}
+
+		if _, ok := da.vals[n.Value]; !ok {
+			da.vals[n.Value] = nvalue{}
+		}
+	}
+
+	for k := range da.vals {
+		if k > da.vkey {
+			da.vkey = k
+		}
+	}
+}
+
+// restored recounts the keys and rebuilds what is derived from them,
+// after the nodes of the cedar were replaced.
+func (da *Cedar) restored() {
+	da.RecountKeys()
+	da.nextValue, da.display, da.vfree = 0, nil, 0
+	for i, n := range da.Array[:da.Size] {
+		if n.Check >= 0 && n.Value >= 0 && !da.Ninfos[i].End {
+			da.used(n.Value)
+		}
+	}
+
+	da.indexRebuild()
+	da.recencyRebuild()
+	da.insertOrderRebuild()
 }
 
 // LoadFromFile loads the cedar from a file,
@@ -66,3 +324,141 @@ func (da *Cedar) LoadFromFile(fileName, dataType string) error {
 
 	return da.Load(in, dataType)
 }
+
+// VerifyFile checks a file saved by SaveToFile, Save or SaveWithCodec,
+// where dataType is either "json" or "gob". It reads the file the way
+// Load does, and checks the trie read like Validate, so a file passes
+// if and only if the cedar loaded from it passes Validate.
+// It is not a streaming check: the gob and json streams hold the trie
+// as a whole, and the files carry no checksum, so it costs a full decode
+// of the trie into memory, only sparing the decoding of the values added
+// by InsertIn, which are checked by their keys only. It returns the
+// errors of the header and of the decoding which Load would return,
+// and an error wrapping ErrCorrupt, if the trie is inconsistent.
+func VerifyFile(fileName, dataType string) (err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	defer func() {
+		// the structure is out of range of the arrays
+		if r := recover(); r != nil {
+			err = ErrCorrupt
+		}
+	}()
+
+	n, err := read(bufio.NewReader(file), dataType, true, nil)
+	if err != nil {
+		return err
+	}
+
+	return n.Validate()
+}
+
+// LoadBlocks assembles a cedar from `count` blocks of 256 nodes fetched
+// one by one, e.g. from a page store the blocks of EachBlock were written
+// to, with their Nodes, NInfos and Block. The values added by InsertIn
+// are not in the blocks, `value` is called with the id of each node
+// holding one to load it with its length, see ValueLen; they are nil
+// if `value` is nil. The lists of blocks are rebuilt, the cedar gets
+// the default settings, and its structure is checked.
+// It will return ErrInvalidDataType, if a block is not 256 nodes,
+// and an error wrapping ErrCorrupt, if the blocks are inconsistent.
+func LoadBlocks(count int, fetch func(index int) ([]Node, []NInfo, Block),
+	value func(id int) (value interface{}, length int)) (da *Cedar, err error) {
+	if count <= 0 {
+		return nil, ErrInvalidDataType
+	}
+
+	da = New()
+	da.Array = make([]node, 0, count<<8)
+	da.Ninfos = make([]ninfo, 0, count<<8)
+	da.Blocks = make([]block, count)
+	for i := 0; i < count; i++ {
+		nodes, ninfos, b := fetch(i)
+		if len(nodes) != 256 || len(ninfos) != 256 || b.Num < 0 || b.Num > 256 {
+			return nil, ErrInvalidDataType
+		}
+
+		da.Array = append(da.Array, nodes...)
+		da.Ninfos = append(da.Ninfos, ninfos...)
+		da.Blocks[i] = b
+	}
+	da.Capacity, da.Size = count<<8, count<<8
+	da.relinkBlocks()
+
+	da.vals = make(map[int]nvalue)
+	for i, n := range da.Array {
+		if n.Check >= 0 && n.Value >= 0 && da.Ninfos[i].End {
+			var v nvalue
+			if value != nil {
+				v.Value, v.Len = value(i)
+			}
+
+			da.vals[n.Value] = v
+			if n.Value > da.vkey {
+				da.vkey = n.Value
+			}
+		}
+	}
+
+	defer func() {
+		// the structure is out of range of the arrays
+		if r := recover(); r != nil {
+			da, err = nil, ErrCorrupt
+		}
+	}()
+
+	if err := da.checkInvariants(); err != nil {
+		return nil, corrupt(err)
+	}
+	da.restored()
+
+	return da, nil
+}
+
+// Bytes saves the cedar into a byte slice,
+// where dataType is either "json" or "gob".
+func (da *Cedar) Bytes(dataType string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := da.Save(&buf, dataType); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// countWriter discards the bytes written to it, only counting them.
+type countWriter struct {
+	n int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// GobSize returns the number of bytes which Save writes in gob,
+// without keeping the encoded cedar, e.g. to check a storage quota
+// before saving it.
+func (da *Cedar) GobSize() (int, error) {
+	var w countWriter
+	if err := da.Save(&w, "gob"); err != nil {
+		return 0, err
+	}
+
+	return w.n, nil
+}
+
+// FromBytes loads a cedar from a byte slice,
+// where dataType is either "json" or "gob".
+func FromBytes(b []byte, dataType string) (*Cedar, error) {
+	da := New()
+	if err := da.Load(bytes.NewReader(b), dataType); err != nil {
+		return nil, err
+	}
+
+	return da, nil
+}
@@ -0,0 +1,306 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+type point struct {
+	X, Y int
+}
+
+// jsonCodec encodes the values as json points.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	var p point
+	err := json.Unmarshal(data, &p)
+	return p, err
+}
+
+func TestSaveWithCodec(t *testing.T) {
+	c := New()
+	err := c.InsertIn([]byte("ab"), "x")
+	tt.Nil(t, err)
+	err = c.InsertIn([]byte("abc"), 3)
+	tt.Nil(t, err)
+	err = c.Insert([]byte("b"), 4)
+	tt.Nil(t, err)
+
+	for _, dataType := range []string{"gob", "json"} {
+		var buf bytes.Buffer
+		err := c.SaveWithCodec(&buf, dataType, nil)
+		tt.Nil(t, err)
+
+		da := New()
+		err = da.LoadWithCodec(&buf, dataType, nil)
+		tt.Nil(t, err)
+
+		id, err := da.Jump([]byte("ab"), 0)
+		tt.Nil(t, err)
+		value, err := da.ValueIn(id)
+		tt.Nil(t, err)
+		tt.Equal(t, "x", value)
+
+		id, err = da.Jump([]byte("abc"), 0)
+		tt.Nil(t, err)
+		value, err = da.ValueIn(id)
+		tt.Nil(t, err)
+		tt.Equal(t, 3, value)
+
+		v, err := da.Get([]byte("b"))
+		tt.Nil(t, err)
+		tt.Equal(t, 4, v)
+
+		// new values must not reuse the loaded keys
+		err = da.InsertIn([]byte("c"), "y")
+		tt.Nil(t, err)
+		tt.Equal(t, 3, len(da.vals))
+	}
+
+	c = New()
+	err = c.InsertIn([]byte("p"), point{1, 2})
+	tt.Nil(t, err)
+
+	var buf bytes.Buffer
+	err = c.SaveWithCodec(&buf, "gob", jsonCodec{})
+	tt.Nil(t, err)
+
+	da := New()
+	err = da.LoadWithCodec(&buf, "gob", jsonCodec{})
+	tt.Nil(t, err)
+	id, err := da.Jump([]byte("p"), 0)
+	tt.Nil(t, err)
+	value, err := da.ValueIn(id)
+	tt.Nil(t, err)
+	tt.Equal(t, point{1, 2}, value)
+
+	_, err = da.ValueIn(0)
+	tt.Equal(t, ErrNoValue, err)
+}
+
+func TestGobSize(t *testing.T) {
+	for _, c := range []*Cedar{New(), cd} {
+		b, err := c.Bytes("gob")
+		tt.Nil(t, err)
+
+		n, err := c.GobSize()
+		tt.Nil(t, err)
+		tt.Equal(t, len(b), n)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	c := New()
+	tt.Nil(t, c.Insert([]byte("ab"), 1))
+
+	for _, dataType := range []string{"gob", "json"} {
+		b, err := c.Bytes(dataType)
+		tt.Nil(t, err)
+		tt.Equal(t, append(magic, formatVersion), b[:len(magic)+1])
+
+		// a newer version is rejected
+		b[len(magic)] = formatVersion + 1
+		l := New()
+		err = l.Load(bytes.NewReader(b), dataType)
+		tt.Equal(t, ErrUnsupportedVersion{Have: formatVersion + 1, Want: formatVersion}, err)
+		tt.Equal(t, "cedar: unsupported format version 2, want 1 or older", err.Error())
+		tt.Equal(t, 256, l.Size)
+
+		_, err = LoadFrozen(bytes.NewReader(b), dataType)
+		_, ok := err.(ErrUnsupportedVersion)
+		tt.True(t, ok)
+
+		b[1] = 'x'
+		err = l.Load(bytes.NewReader(b), dataType)
+		tt.Equal(t, ErrInvalidDataType, err)
+
+		// the cedars saved without the header are loaded
+		var buf bytes.Buffer
+		enc, err := newEncoder(&buf, dataType)
+		tt.Nil(t, err)
+		tt.Nil(t, enc.Encode(c))
+		tt.Nil(t, l.Load(&buf, dataType))
+		value, err := l.Get([]byte("ab"))
+		tt.Nil(t, err)
+		tt.Equal(t, 1, value)
+		tt.Equal(t, 1, l.NumKeys())
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cedar")
+	tt.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	c := New()
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+	tt.Nil(t, c.InsertIn([]byte("point"), point{1, 2}))
+
+	for _, dataType := range []string{"gob", "json"} {
+		name := filepath.Join(dir, "cedar."+dataType)
+		tt.Nil(t, c.SaveToFile(name, dataType))
+		tt.Nil(t, VerifyFile(name, dataType))
+
+		var buf bytes.Buffer
+		tt.Nil(t, c.SaveWithCodec(&buf, dataType, jsonCodec{}))
+		tt.Nil(t, ioutil.WriteFile(name, buf.Bytes(), 0666))
+		tt.Nil(t, VerifyFile(name, dataType))
+
+		b, err := c.Bytes(dataType)
+		tt.Nil(t, err)
+		b[len(magic)] = formatVersion + 1
+		tt.Nil(t, ioutil.WriteFile(name, b, 0666))
+		_, ok := VerifyFile(name, dataType).(ErrUnsupportedVersion)
+		tt.True(t, ok)
+
+		// a node whose parent is gone
+		to, err := c.Jump([]byte("abcdefghijklmn"), 0)
+		tt.Nil(t, err)
+		broken := *c
+		broken.Array = append([]node(nil), c.Array...)
+		broken.Array[to].Check = c.Size - 1
+		b, err = broken.Bytes(dataType)
+		tt.Nil(t, err)
+		tt.Nil(t, ioutil.WriteFile(name, b, 0666))
+		err = VerifyFile(name, dataType)
+		tt.True(t, errors.Is(err, ErrCorrupt))
+
+		// it agrees with Validate after a Load
+		da := New()
+		tt.Nil(t, da.LoadFromFile(name, dataType))
+		tt.True(t, errors.Is(da.Validate(), ErrCorrupt))
+
+		tt.Nil(t, c.SaveToFile(name, dataType))
+		tt.Nil(t, da.LoadFromFile(name, dataType))
+		tt.Nil(t, da.Validate())
+		tt.Nil(t, da.InsertIn([]byte("after"), "after"))
+		tt.Nil(t, da.Validate())
+		id, err := da.Jump([]byte("point"), 0)
+		tt.Nil(t, err)
+		v, err := da.ValueIn(id)
+		tt.Nil(t, err)
+		tt.Nil(t, v)
+	}
+
+	tt.NotNil(t, VerifyFile(filepath.Join(dir, "none"), "gob"))
+}
+
+func TestLoadBlocks(t *testing.T) {
+	c := New()
+	for i, word := range words {
+		tt.Nil(t, c.Insert([]byte(word), i))
+	}
+	tt.Nil(t, c.InsertInLen([]byte("point"), point{1, 2}, 3))
+
+	type page struct {
+		nodes  []Node
+		ninfos []NInfo
+		block  Block
+	}
+	var pages []page
+	c.EachBlock(func(b BlockInfo) bool {
+		pages = append(pages, page{
+			nodes:  append([]Node(nil), b.Nodes...),
+			ninfos: append([]NInfo(nil), b.NInfos...),
+			block:  b.Block,
+		})
+		return true
+	})
+	fetch := func(i int) ([]Node, []NInfo, Block) {
+		return pages[i].nodes, pages[i].ninfos, pages[i].block
+	}
+	value := func(id int) (interface{}, int) {
+		v, err := c.ValueIn(id)
+		tt.Nil(t, err)
+		n, _ := c.ValueLen(id)
+		return v, n
+	}
+
+	l, err := LoadBlocks(len(pages), fetch, value)
+	tt.Nil(t, err)
+	tt.Equal(t, c.NumKeys(), l.NumKeys())
+	for i, word := range words {
+		v, err := l.Get([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, i, v)
+	}
+
+	id, err := l.Jump([]byte("point"), 0)
+	tt.Nil(t, err)
+	v, err := l.ValueIn(id)
+	tt.Nil(t, err)
+	tt.Equal(t, point{1, 2}, v)
+	n, _ := l.ValueLen(id)
+	tt.Equal(t, 3, n)
+
+	// the lists of blocks are usable
+	for i, word := range words {
+		tt.Nil(t, l.Insert([]byte(word+"x"), i))
+	}
+	tt.Nil(t, l.checkInvariants())
+
+	_, err = LoadBlocks(0, fetch, nil)
+	tt.Equal(t, ErrInvalidDataType, err)
+	_, err = LoadBlocks(1, func(int) ([]Node, []NInfo, Block) {
+		return pages[0].nodes[:10], pages[0].ninfos, pages[0].block
+	}, nil)
+	tt.Equal(t, ErrInvalidDataType, err)
+
+	// the first block only, whose nodes have children in the others
+	_, err = LoadBlocks(1, fetch, nil)
+	tt.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestDeterministic(t *testing.T) {
+	saved := func(da *Cedar) []byte {
+		var buf bytes.Buffer
+		tt.Nil(t, da.SaveWithCodec(&buf, "gob", nil))
+		return buf.Bytes()
+	}
+	modify := func(da *Cedar) {
+		tt.Nil(t, da.InsertIn([]byte("x"), "x"))
+		tt.Nil(t, da.InsertIn([]byte("y"), "y"))
+	}
+
+	for _, deterministic := range []bool{false, true} {
+		var opts []Option
+		if deterministic {
+			opts = append(opts, WithDeterministic())
+		}
+
+		da := New(opts...)
+		for _, key := range []string{"a", "b", "c", "d"} {
+			tt.Nil(t, da.InsertIn([]byte(key), key))
+		}
+		tt.Nil(t, da.Delete([]byte("b")))
+		tt.Nil(t, da.Delete([]byte("d")))
+
+		loaded := New(opts...)
+		tt.Nil(t, loaded.LoadWithCodec(bytes.NewReader(saved(da)), "gob", nil))
+		modify(da)
+		modify(loaded)
+
+		tt.Equal(t, deterministic, bytes.Equal(saved(da), saved(loaded)))
+		for _, key := range []string{"a", "c", "x", "y"} {
+			id, err := loaded.Jump([]byte(key), 0)
+			tt.Nil(t, err)
+			v, err := loaded.ValueIn(id)
+			tt.Nil(t, err)
+			tt.Equal(t, key, v)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cedar
+
+import "container/list"
+
+// keyList is a list of keys, with their elements by key.
+type keyList struct {
+	order *list.List // of the keys as strings
+	elems map[string]*list.Element
+}
+
+func (l *keyList) reset() {
+	l.order = list.New()
+	l.elems = make(map[string]*list.Element)
+}
+
+// touch moves the key to the front of the list, or adds it there.
+func (l *keyList) touch(key []byte) {
+	if l == nil {
+		return
+	}
+
+	if e, ok := l.elems[string(key)]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elems[string(key)] = l.order.PushFront(string(key))
+}
+
+// add adds the key to the back of the list, if not there yet.
+func (l *keyList) add(key []byte) {
+	if l == nil {
+		return
+	}
+
+	if _, ok := l.elems[string(key)]; !ok {
+		l.elems[string(key)] = l.order.PushBack(string(key))
+	}
+}
+
+// remove removes the key from the list, if there.
+func (l *keyList) remove(key []byte) {
+	if l == nil {
+		return
+	}
+
+	if e, ok := l.elems[string(key)]; ok {
+		l.order.Remove(e)
+		delete(l.elems, string(key))
+	}
+}
+
+// recency keeps the keys of a cedar from the most to the least
+// recently inserted, or accessed, see WithCapacityLimit.
+type recency struct {
+	keyList
+
+	limit  int
+	access bool
+}
+
+// WithCapacityLimit makes the cedar hold at most `n` keys, as a cache:
+// an insertion beyond `n` keys deletes the least recently inserted key,
+// calling the OnDelete hook for it. Insert, InsertIn and Update
+// count as insertions, use WithAccessTracking to count Get as well.
+// The cedar keeps a list of its keys for it, each insertion costs O(1)
+// more, and the memory of a copy of each key.
+func WithCapacityLimit(n int) Option {
+	return func(da *Cedar) {
+		if da.recency == nil {
+			da.recency = &recency{}
+		}
+		da.recency.limit = n
+		da.recency.reset()
+	}
+}
+
+// WithAccessTracking makes a successful Get, Value or ValueIn count as
+// an insertion for WithCapacityLimit, so the least recently used key
+// is deleted. Value and ValueIn then also rebuild the key of the node,
+// and they modify the cedar, so they must not run concurrently
+// with any other method.
+func WithAccessTracking() Option {
+	return func(da *Cedar) {
+		if da.recency == nil {
+			da.recency = &recency{}
+			da.recency.reset()
+		}
+		da.recency.access = true
+	}
+}
+
+// touch makes the key the most recent one, if tracked.
+func (r *recency) touch(key []byte) {
+	if r != nil {
+		r.keyList.touch(key)
+	}
+}
+
+// remove removes the key, if tracked.
+func (r *recency) remove(key []byte) {
+	if r != nil {
+		r.keyList.remove(key)
+	}
+}
+
+// inserted records the insertion of the key, and deletes
+// the least recent keys beyond the capacity limit.
+func (da *Cedar) inserted(key []byte) {
+	r := da.recency
+	if r == nil {
+		return
+	}
+
+	r.touch(key)
+	for r.limit > 0 && r.order.Len() > r.limit {
+		oldest := r.order.Back().Value.(string)
+		if err := da.Delete([]byte(oldest)); err != nil {
+			// not in the cedar anymore, forget it
+			r.remove([]byte(oldest))
+		}
+	}
+}
+
+// recencyRebuild tracks all the keys, in the order of the keys, if any.
+func (da *Cedar) recencyRebuild() {
+	r := da.recency
+	if r == nil {
+		return
+	}
+
+	r.reset()
+	da.walk(0, func(id int, key []byte) bool {
+		r.touch(key)
+		return true
+	})
+}
+
+// WithMaxKeys makes the cedar a bounded cache of at most `n` keys,
+// evicting the least recently used key: it is WithCapacityLimit
+// with WithAccessTracking, and it costs the same bookkeeping.
+func WithMaxKeys(n int) Option {
+	return func(da *Cedar) {
+		WithCapacityLimit(n)(da)
+		WithAccessTracking()(da)
+	}
+}
@@ -0,0 +1,99 @@
+package cedar
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestCapacityLimit(t *testing.T) {
+	c := New(WithCapacityLimit(3))
+	var evicted []string
+	c.OnDelete(func(key []byte) {
+		evicted = append(evicted, string(key))
+	})
+
+	for i, key := range []string{"a", "ab", "b", "abc"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+	tt.Equal(t, []string{"a"}, evicted)
+
+	// an update is an insertion, a Get is not
+	tt.Nil(t, c.Update([]byte("ab"), 1))
+	_, err := c.Get([]byte("b"))
+	tt.Nil(t, err)
+	tt.Nil(t, c.InsertIn([]byte("c"), "c"))
+	tt.Equal(t, []string{"a", "b"}, evicted)
+
+	tt.Nil(t, c.Delete([]byte("abc")))
+	tt.Nil(t, c.Insert([]byte("d"), 4))
+	tt.Equal(t, []string{"a", "b", "abc"}, evicted)
+
+	keys, _, _, _ := c.Status()
+	tt.Equal(t, 3, keys)
+	for _, key := range []string{"ab", "c", "d"} {
+		_, err := c.Get([]byte(key))
+		tt.Nil(t, err)
+	}
+}
+
+func TestAccessTracking(t *testing.T) {
+	c := New(WithCapacityLimit(2), WithAccessTracking())
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.Insert([]byte("b"), 2))
+
+	_, err := c.Get([]byte("a"))
+	tt.Nil(t, err)
+	tt.Nil(t, c.Insert([]byte("c"), 3))
+
+	_, err = c.Get([]byte("b"))
+	tt.NotNil(t, err)
+	_, err = c.Get([]byte("a"))
+	tt.Nil(t, err)
+
+	b, err := c.Bytes("gob")
+	tt.Nil(t, err)
+	l := New(WithCapacityLimit(2))
+	tt.Nil(t, l.Load(bytes.NewReader(b), "gob"))
+	tt.Nil(t, l.Insert([]byte("d"), 4))
+	_, err = l.Get([]byte("a"))
+	tt.NotNil(t, err)
+}
+
+func TestMaxKeys(t *testing.T) {
+	c := New(WithMaxKeys(2))
+	tt.Nil(t, c.Insert([]byte("a"), 1))
+	tt.Nil(t, c.InsertIn([]byte("b"), "b"))
+
+	// the accesses by id keep the keys
+	id, err := c.Jump([]byte("a"), 0)
+	tt.Nil(t, err)
+	_, err = c.Value(id)
+	tt.Nil(t, err)
+	tt.Nil(t, c.Insert([]byte("c"), 3))
+	_, err = c.Get([]byte("b"))
+	tt.NotNil(t, err)
+
+	id, err = c.Jump([]byte("a"), 0)
+	tt.Nil(t, err)
+	_, err = c.Value(id)
+	tt.Nil(t, err)
+	tt.Nil(t, c.InsertIn([]byte("d"), "d"))
+	id, _ = c.Jump([]byte("d"), 0)
+	_, err = c.ValueIn(id)
+	tt.Nil(t, err)
+	tt.Nil(t, c.Insert([]byte("e"), 5))
+
+	tt.Equal(t, 2, c.NumKeys())
+	for _, key := range []string{"d", "e"} {
+		_, err := c.Jump([]byte(key), 0)
+		tt.Nil(t, err)
+	}
+
+	// the matches do not count as accesses
+	c.PrefixMatch([]byte("d"), 0)
+	tt.Nil(t, c.Insert([]byte("f"), 6))
+	_, err = c.Jump([]byte("d"), 0)
+	tt.NotNil(t, err)
+}
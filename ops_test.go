@@ -0,0 +1,89 @@
+package cedar
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+var opKeys = []string{
+	"a", "aa", "ab", "abc", "abcd", "abd", "b", "ba", "bcd",
+	"\x01", "\x01\x01", "\x01\x02", "\xff", "\xff\xfe",
+	"太阳", "太阳系", "新星", "新星军团",
+}
+
+// applyOps applies the insertions, updates and deletions encoded
+// in data to a cedar and a reference map, and checks after each one
+// that the cedar is consistent and holds the same keys as the map.
+func applyOps(t *testing.T, data []byte) {
+	c := New()
+	m := make(map[string]int)
+
+	for ; len(data) >= 3; data = data[3:] {
+		key := opKeys[int(data[1])%len(opKeys)]
+		value := int(data[2])
+
+		switch data[0] % 3 {
+		case 0:
+			tt.Nil(t, c.Insert([]byte(key), value))
+			m[key] = value
+		case 1:
+			tt.Nil(t, c.Update([]byte(key), value))
+			m[key] += value
+		case 2:
+			err := c.Delete([]byte(key))
+			if _, ok := m[key]; ok {
+				tt.Nil(t, err)
+				delete(m, key)
+			} else {
+				tt.Equal(t, ErrNoPath, err)
+			}
+		}
+
+		tt.Nil(t, c.checkInvariants())
+		for _, key := range opKeys {
+			value, err := c.Get([]byte(key))
+			if v, ok := m[key]; ok {
+				tt.Nil(t, err)
+				tt.Equal(t, v, value)
+			} else {
+				tt.NotNil(t, err)
+			}
+		}
+
+		keys, _, _, _ := c.Status()
+		tt.Equal(t, len(m), keys)
+		tt.Equal(t, len(m), c.NumKeys())
+
+		n := 0
+		c.ForEach(func(key []byte, value int) bool {
+			tt.Equal(t, m[string(key)], value)
+			n++
+			return true
+		})
+		tt.Equal(t, len(m), n)
+	}
+}
+
+func TestRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		data := make([]byte, 3*r.Intn(200))
+		r.Read(data)
+		applyOps(t, data)
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	tt.Nil(t, New().checkInvariants())
+	tt.Nil(t, cd.checkInvariants())
+
+	c := New()
+	tt.Nil(t, c.Insert([]byte("ab"), 1))
+	id, err := c.Jump([]byte("ab"), 0)
+	tt.Nil(t, err)
+
+	c.Array[id].Check = 0
+	tt.NotNil(t, c.checkInvariants())
+}
@@ -0,0 +1,49 @@
+package cedar
+
+// WithInsertOrder makes the cedar track the order in which its keys
+// were first inserted, for ForEachInserted. Inserting a key again
+// keeps its place, and deleting it removes it from the order.
+// The cedar keeps a list of its keys for it, each insertion and
+// deletion costs O(1) more, and the memory of a copy of each key.
+// The order is not saved, a loaded cedar starts in the order of the keys.
+func WithInsertOrder() Option {
+	return func(da *Cedar) {
+		da.insertOrder = &keyList{}
+		da.insertOrder.reset()
+	}
+}
+
+// ForEachInserted calls fn for each key with the id of its value node,
+// in the order in which the keys were inserted, until fn returns false.
+// It requires WithInsertOrder, and calls nothing otherwise.
+// fn must not modify the cedar.
+func (da *Cedar) ForEachInserted(fn func(key []byte, id int) bool) {
+	if da.insertOrder == nil {
+		return
+	}
+
+	for e := da.insertOrder.order.Front(); e != nil; e = e.Next() {
+		key := []byte(e.Value.(string))
+		to, err := da.Jump(key, 0)
+		if err != nil {
+			continue
+		}
+
+		if to, ok := da.valueNode(to); ok && !fn(key, to) {
+			return
+		}
+	}
+}
+
+// insertOrderRebuild tracks all the keys, in the order of the keys, if any.
+func (da *Cedar) insertOrderRebuild() {
+	if da.insertOrder == nil {
+		return
+	}
+
+	da.insertOrder.reset()
+	da.walk(0, func(id int, key []byte) bool {
+		da.insertOrder.add(key)
+		return true
+	})
+}
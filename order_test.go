@@ -0,0 +1,54 @@
+package cedar
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func inserted(c *Cedar) (keys []string) {
+	c.ForEachInserted(func(key []byte, id int) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	return
+}
+
+func TestInsertOrder(t *testing.T) {
+	c := New(WithInsertOrder())
+	for i, key := range []string{"b", "abc", "a", "ab"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+	tt.Nil(t, c.InsertIn([]byte("c"), "c"))
+	tt.Equal(t, []string{"b", "abc", "a", "ab", "c"}, inserted(c))
+
+	// an update keeps its place, a deleted key loses it
+	tt.Nil(t, c.Update([]byte("abc"), 1))
+	tt.Nil(t, c.Delete([]byte("b")))
+	tt.Nil(t, c.Insert([]byte("b"), 5))
+	tt.Equal(t, []string{"abc", "a", "ab", "c", "b"}, inserted(c))
+
+	c.ForEachInserted(func(key []byte, id int) bool {
+		if string(key) == "c" {
+			v, err := c.ValueIn(id)
+			tt.Nil(t, err)
+			tt.Equal(t, "c", v)
+		} else {
+			v, err := c.Value(id)
+			tt.Nil(t, err)
+			w, _ := c.Get(key)
+			tt.Equal(t, w, v)
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	tt.Nil(t, c.Save(&buf, "gob"))
+	tt.Nil(t, c.Load(&buf, "gob"))
+	tt.Equal(t, []string{"a", "ab", "abc", "b", "c"}, inserted(c))
+
+	tt.Nil(t, c.Clear())
+	tt.Equal(t, 0, len(inserted(c)))
+	tt.Equal(t, 0, len(inserted(New())))
+}
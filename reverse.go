@@ -0,0 +1,87 @@
+package cedar
+
+// ReverseCedar stores its keys reversed, so that suffix queries
+// become prefix queries on the underlying cedar.
+// Use the *Reverse methods to work with keys in their natural order,
+// the embedded Cedar sees the reversed keys.
+// If both prefix and suffix queries are needed, a Cedar and a ReverseCedar
+// have to be kept side by side, which doubles the storage.
+type ReverseCedar struct {
+	*Cedar
+}
+
+// NewReverse new ReverseCedar
+func NewReverse(opts ...Option) *ReverseCedar {
+	return &ReverseCedar{New(opts...)}
+}
+
+// InsertReverse adds a key-value pair into the cedar, storing the key reversed.
+func (rc *ReverseCedar) InsertReverse(key []byte, value int) error {
+	return rc.Insert(reverse(key), value)
+}
+
+// GetReverse returns the value associated with the given `key`.
+func (rc *ReverseCedar) GetReverse(key []byte) (int, error) {
+	return rc.Get(reverse(key))
+}
+
+// DeleteReverse removes a key-value pair from the cedar.
+func (rc *ReverseCedar) DeleteReverse(key []byte) error {
+	return rc.Delete(reverse(key))
+}
+
+// KeyReverse returns the key of the node with the given `id`,
+// in its natural order.
+func (rc *ReverseCedar) KeyReverse(id int) ([]byte, error) {
+	key, err := rc.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return reverse(key), nil
+}
+
+// SuffixMatch returns a list of at most `num` nodes
+// whose keys are suffixes of the key, from the shortest to the longest.
+// If `num` is 0, it returns all matches.
+func (rc *ReverseCedar) SuffixMatch(key []byte, num int) []int {
+	return rc.PrefixMatch(reverse(key), num)
+}
+
+// LongestSuffixMatch returns the node id and the length of the longest
+// key which is a suffix of the text, e.g. "example.com" for the text
+// "www.example.com" with the keys "com" and "example.com".
+// It returns false, if no key is a suffix of the text.
+func (rc *ReverseCedar) LongestSuffixMatch(text []byte) (id, n int, ok bool) {
+	from := 0
+	for i := len(text) - 1; i >= 0; i-- {
+		to, ok := rc.Step(from, text[i])
+		if !ok {
+			break
+		}
+
+		if _, ok := rc.valueNode(to); ok {
+			id, n = to, len(text)-i
+		}
+		from = to
+	}
+
+	return id, n, n > 0
+}
+
+// SuffixPredict returns a list of at most `num` nodes
+// whose keys end with the suffix.
+// If `num` is 0, it returns all matches.
+func (rc *ReverseCedar) SuffixPredict(suffix []byte, num int) []int {
+	return rc.PrefixPredict(reverse(suffix), num)
+}
+
+// reverse returns a reversed copy of the key.
+func reverse(key []byte) []byte {
+	rev := make([]byte, len(key))
+	for i, b := range key {
+		rev[len(key)-1-i] = b
+	}
+
+	return rev
+}
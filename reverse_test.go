@@ -0,0 +1,50 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestReverseCedar(t *testing.T) {
+	rc := NewReverse()
+	for i, word := range []string{"example.com", "mail.example.com",
+		"example.org", "com"} {
+		err := rc.InsertReverse([]byte(word), i)
+		tt.Nil(t, err)
+	}
+
+	value, err := rc.GetReverse([]byte("example.org"))
+	tt.Nil(t, err)
+	tt.Equal(t, 2, value)
+
+	keys := func(ids []int) (keys []string) {
+		for _, id := range ids {
+			key, err := rc.KeyReverse(id)
+			tt.Nil(t, err)
+			keys = append(keys, string(key))
+		}
+		return
+	}
+
+	ids := rc.SuffixMatch([]byte("www.mail.example.com"), 0)
+	tt.Equal(t, []string{"com", "example.com", "mail.example.com"}, keys(ids))
+
+	ids = rc.SuffixPredict([]byte(".com"), 0)
+	tt.Equal(t, []string{"example.com", "mail.example.com"}, keys(ids))
+
+	err = rc.DeleteReverse([]byte("example.com"))
+	tt.Nil(t, err)
+	ids = rc.SuffixPredict([]byte("com"), 0)
+	tt.Equal(t, []string{"com", "mail.example.com"}, keys(ids))
+
+	id, n, ok := rc.LongestSuffixMatch([]byte("www.mail.example.com"))
+	tt.True(t, ok)
+	tt.Equal(t, len("mail.example.com"), n)
+	key, err := rc.KeyReverse(id)
+	tt.Nil(t, err)
+	tt.Equal(t, "mail.example.com", string(key))
+
+	_, _, ok = rc.LongestSuffixMatch([]byte("example.xyz"))
+	tt.False(t, ok)
+}
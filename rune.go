@@ -0,0 +1,60 @@
+package cedar
+
+import "unicode/utf8"
+
+// ValidRuneBoundary reports whether the first `n` bytes of the key
+// end at a rune boundary, i.e. do not split a multi-byte UTF-8 sequence.
+func ValidRuneBoundary(key []byte, n int) bool {
+	if n < 0 || n > len(key) {
+		return false
+	}
+
+	return n == 0 || n == len(key) || utf8.RuneStart(key[n])
+}
+
+// PrefixPredictRune is like PrefixPredict for text keys, starting from
+// the node `from`. It only returns the keys which are valid UTF-8 and
+// extend the prefix at a rune boundary, so a prefix ending in the middle
+// of a multi-byte character does not match the keys sharing its bytes.
+func (da *Cedar) PrefixPredictRune(prefix string, from int) (ids []int) {
+	root, err := da.Jump([]byte(prefix), from)
+	if err != nil {
+		return
+	}
+
+	depth := 0
+	if root != 0 {
+		key, err := da.Key(root)
+		if err != nil {
+			return
+		}
+		depth = len(key)
+	}
+
+	for _, id := range da.predict(root, 0, true) {
+		key, err := da.Key(id)
+		if err != nil {
+			continue
+		}
+
+		if utf8.Valid(key) && ValidRuneBoundary(key, depth) {
+			ids = append(ids, id)
+		}
+	}
+
+	return
+}
+
+// ValidateUTF8 returns the keys which are not valid UTF-8, in their
+// byte order, e.g. to find the keys of a mis-decoded source after a load.
+// It checks the keys of both kinds of values, in a walk of all the keys.
+func (da *Cedar) ValidateUTF8() (badKeys [][]byte) {
+	da.walk(0, func(_ int, key []byte) bool {
+		if !utf8.Valid(key) {
+			badKeys = append(badKeys, append([]byte(nil), key...))
+		}
+		return true
+	})
+
+	return
+}
@@ -0,0 +1,54 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestValidRuneBoundary(t *testing.T) {
+	key := []byte("a新")
+	tt.True(t, ValidRuneBoundary(key, 0))
+	tt.True(t, ValidRuneBoundary(key, 1))
+	tt.False(t, ValidRuneBoundary(key, 2))
+	tt.False(t, ValidRuneBoundary(key, 3))
+	tt.True(t, ValidRuneBoundary(key, 4))
+	tt.False(t, ValidRuneBoundary(key, 5))
+}
+
+func TestPrefixPredictRune(t *testing.T) {
+	c := New()
+	for i, word := range []string{"新星", "新星军团", "新", "文明"} {
+		err := c.Insert([]byte(word), i)
+		tt.Nil(t, err)
+	}
+	err := c.Insert([]byte("新\xff"), 4)
+	tt.Nil(t, err)
+
+	ids := c.PrefixPredictRune("新", 0)
+	check(c, ids, []string{"新", "新星", "新星军团"}, []int{2, 0, 1})
+
+	// "新星" without its last byte
+	partial := "新星"[:5]
+	tt.Equal(t, 2, len(c.PrefixPredict([]byte(partial), 0)))
+	tt.Equal(t, 0, len(c.PrefixPredictRune(partial, 0)))
+
+	from, err := c.Jump([]byte("新"), 0)
+	tt.Nil(t, err)
+	ids = c.PrefixPredictRune("星", from)
+	check(c, ids, []string{"新星", "新星军团"}, []int{0, 1})
+	tt.Equal(t, 0, len(c.PrefixPredictRune("星"[:1], from)))
+}
+
+func TestValidateUTF8(t *testing.T) {
+	da := New()
+	tt.Equal(t, 0, len(da.ValidateUTF8()))
+
+	tt.Nil(t, da.Insert([]byte("太阳"), 1))
+	tt.Nil(t, da.Insert([]byte("\xe5\xa4"), 2))
+	tt.Nil(t, da.InsertIn([]byte("a\xff"), "a"))
+	tt.Nil(t, da.Insert([]byte("ascii"), 3))
+
+	tt.Equal(t, [][]byte{[]byte("a\xff"), []byte("\xe5\xa4")}, da.ValidateUTF8())
+	tt.Equal(t, 0, len(cd.ValidateUTF8()))
+}
@@ -0,0 +1,42 @@
+package cedar
+
+import "bytes"
+
+// SegmentMatch matches the query against the stored keys as patterns
+// of `sep` delimited segments, where a stored segment "*" matches any
+// one segment of the query, e.g. the keys "a/b/c", "a/*/c" and "*/b/c"
+// all match the query "a/b/c". A key only matches with the same
+// number of segments as the query.
+//
+// It returns the ids of the matching keys by precedence: from the
+// first segment on, an exact segment goes before a wildcard, so the
+// first id is the most specific match, "a/b/c", then "a/*/c",
+// then "*/b/c" above.
+func (da *Cedar) SegmentMatch(query []byte, sep byte) (ids []int) {
+	return da.segmentMatch(ids, 0, bytes.Split(query, []byte{sep}), sep)
+}
+
+// segmentMatch appends the matches of the segments from the node `from`.
+func (da *Cedar) segmentMatch(ids []int, from int, segs [][]byte,
+	sep byte) []int {
+	for _, seg := range [][]byte{segs[0], []byte("*")} {
+		to, err := da.Jump(seg, from)
+		if err != nil {
+			continue
+		}
+
+		if len(segs) == 1 {
+			if _, ok := da.valueNode(to); ok {
+				ids = append(ids, to)
+			}
+		} else if to, ok := da.Step(to, sep); ok {
+			ids = da.segmentMatch(ids, to, segs[1:], sep)
+		}
+
+		if bytes.Equal(segs[0], []byte("*")) {
+			break
+		}
+	}
+
+	return ids
+}
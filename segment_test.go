@@ -0,0 +1,32 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestSegmentMatch(t *testing.T) {
+	c := New()
+	for i, key := range []string{"a/b/c", "a/*/c", "*/b/c", "*/*/*",
+		"a/b", "a/*", "a//c", "*/b/c/d"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	match := func(query string) (keys []string) {
+		for _, id := range c.SegmentMatch([]byte(query), '/') {
+			key, err := c.Key(id)
+			tt.Nil(t, err)
+			keys = append(keys, string(key))
+		}
+		return
+	}
+
+	tt.Equal(t, []string{"a/b/c", "a/*/c", "*/b/c", "*/*/*"}, match("a/b/c"))
+	tt.Equal(t, []string{"a/*/c", "*/*/*"}, match("a/x/c"))
+	tt.Equal(t, []string{"a//c", "a/*/c", "*/*/*"}, match("a//c"))
+	tt.Equal(t, []string{"a/b", "a/*"}, match("a/b"))
+	tt.Equal(t, []string{"*/*/*"}, match("*/*/*"))
+	tt.Equal(t, 0, len(match("b")))
+	tt.Equal(t, 0, len(match("a/b/c/d/e")))
+}
@@ -0,0 +1,132 @@
+package cedar
+
+// CedarSet is a set of keys built on the double-array of Cedar.
+// It only records membership: a key is in the set when its terminal node
+// holds a value, so no value map is kept.
+type CedarSet struct {
+	da *Cedar
+}
+
+// NewSet new CedarSet
+func NewSet() *CedarSet {
+	da := New()
+	da.vals = nil
+
+	return &CedarSet{da}
+}
+
+// Add adds the key into the set.
+func (s *CedarSet) Add(key []byte) error {
+	return s.da.Insert(key, 0)
+}
+
+// Contains reports whether the key is in the set.
+func (s *CedarSet) Contains(key []byte) bool {
+	_, err := s.da.Get(key)
+	return err == nil
+}
+
+// Remove removes the key from the set.
+// It will return ErrNoPath, if the key is not in the set.
+func (s *CedarSet) Remove(key []byte) error {
+	if !s.Contains(key) {
+		return ErrNoPath
+	}
+
+	return s.da.Delete(key)
+}
+
+// Len returns the number of keys in the set.
+func (s *CedarSet) Len() int {
+	keys, _, _, _ := s.da.Status()
+	return keys
+}
+
+// MembershipCedar maps the keys to the slots of a flat array of values
+// kept by the caller, e.g. to store the payloads out of the trie.
+// Like CedarSet it keeps no value map: the value of each key is its slot,
+// a small integer assigned by Insert and reused after Delete.
+// The node ids move as the trie grows, so the slots are the stable handles,
+// and Value returns the raw slot of a node.
+type MembershipCedar struct {
+	da   *Cedar
+	free []int // the slots freed by Delete
+	next int   // the slot assigned next, if none is free
+}
+
+// NewMembership new MembershipCedar
+func NewMembership() *MembershipCedar {
+	da := New()
+	da.vals = nil
+
+	return &MembershipCedar{da: da}
+}
+
+// Insert adds the key, and returns its slot.
+// If the key is already in, it returns its slot.
+func (m *MembershipCedar) Insert(key []byte) (slot int, err error) {
+	if slot, err := m.da.Get(key); err == nil {
+		return slot, nil
+	}
+
+	if n := len(m.free); n > 0 {
+		slot = m.free[n-1]
+	} else {
+		slot = m.next
+	}
+
+	if err := m.da.Insert(key, slot); err != nil {
+		return 0, err
+	}
+
+	if n := len(m.free); n > 0 {
+		m.free = m.free[:n-1]
+	} else {
+		m.next++
+	}
+
+	return slot, nil
+}
+
+// Get returns the slot of the key, or an error like Cedar.Get.
+func (m *MembershipCedar) Get(key []byte) (slot int, err error) {
+	return m.da.Get(key)
+}
+
+// Contains reports whether the key is in.
+func (m *MembershipCedar) Contains(key []byte) bool {
+	_, err := m.da.Get(key)
+	return err == nil
+}
+
+// Value returns the raw slot held by the node `id`, e.g. from Jump.
+func (m *MembershipCedar) Value(id int) (slot int, err error) {
+	return m.da.Value(id)
+}
+
+// Jump travels from the node `from` along the path, see Cedar.Jump.
+func (m *MembershipCedar) Jump(path []byte, from int) (to int, err error) {
+	return m.da.Jump(path, from)
+}
+
+// Delete removes the key, and returns its slot, which is free to be
+// reused by the next Insert.
+// It will return ErrNoPath, if the key is not in.
+func (m *MembershipCedar) Delete(key []byte) (slot int, err error) {
+	slot, err = m.da.Get(key)
+	if err != nil {
+		return 0, ErrNoPath
+	}
+
+	if err := m.da.Delete(key); err != nil {
+		return 0, err
+	}
+	m.free = append(m.free, slot)
+
+	return slot, nil
+}
+
+// Len returns the number of keys.
+func (m *MembershipCedar) Len() int {
+	return m.da.NumKeys()
+}
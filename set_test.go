@@ -0,0 +1,71 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestCedarSet(t *testing.T) {
+	s := NewSet()
+	for _, word := range words {
+		err := s.Add([]byte(word))
+		tt.Nil(t, err)
+	}
+	tt.Equal(t, len(words), s.Len())
+
+	for i := 0; i < len(words); i += 2 {
+		err := s.Remove([]byte(words[i]))
+		tt.Nil(t, err)
+	}
+
+	for i, word := range words {
+		tt.Equal(t, i%2 == 1, s.Contains([]byte(word)))
+	}
+	tt.Equal(t, len(words)/2, s.Len())
+
+	tt.Equal(t, ErrNoPath, s.Remove([]byte("ab")))
+	tt.Equal(t, ErrNoPath, s.Remove([]byte("太阳")))
+	tt.True(t, s.Contains([]byte("太阳系水星")))
+}
+
+func TestMembershipCedar(t *testing.T) {
+	m := NewMembership()
+	payloads := make([]string, 0)
+	for _, word := range words {
+		slot, err := m.Insert([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, len(payloads), slot)
+		payloads = append(payloads, word)
+	}
+	tt.Equal(t, len(words), m.Len())
+
+	slot, err := m.Insert([]byte(words[3]))
+	tt.Nil(t, err)
+	tt.Equal(t, 3, slot)
+
+	for i, word := range words {
+		slot, err := m.Get([]byte(word))
+		tt.Nil(t, err)
+		tt.Equal(t, word, payloads[slot])
+
+		id, err := m.Jump([]byte(word), 0)
+		tt.Nil(t, err)
+		slot, err = m.Value(id)
+		tt.Nil(t, err)
+		tt.Equal(t, i, slot)
+	}
+
+	slot, err = m.Delete([]byte(words[5]))
+	tt.Nil(t, err)
+	tt.Equal(t, 5, slot)
+	tt.False(t, m.Contains([]byte(words[5])))
+	_, err = m.Delete([]byte(words[5]))
+	tt.Equal(t, ErrNoPath, err)
+
+	slot, err = m.Insert([]byte("新词"))
+	tt.Nil(t, err)
+	tt.Equal(t, 5, slot)
+	tt.Equal(t, len(words), m.Len())
+	tt.Nil(t, m.da.checkInvariants())
+}
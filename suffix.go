@@ -0,0 +1,52 @@
+package cedar
+
+// SuffixTrie is a ReverseCedar for the queries on the ends of the keys,
+// e.g. the domain suffixes. Unlike ReverseCedar, it does not expose the
+// reversed cedar: its methods take and return the keys in their natural
+// orientation only, so the keys can not be inserted reversed twice
+// by mistake. The node ids are those of the underlying cedar.
+type SuffixTrie struct {
+	rc *ReverseCedar
+}
+
+// NewSuffixTrie new SuffixTrie
+func NewSuffixTrie(opts ...Option) *SuffixTrie {
+	return &SuffixTrie{rc: NewReverse(opts...)}
+}
+
+// Insert adds a key-value pair, like Cedar.Insert.
+func (s *SuffixTrie) Insert(key []byte, value int) error {
+	return s.rc.InsertReverse(key, value)
+}
+
+// Get returns the value of the key, like Cedar.Get.
+func (s *SuffixTrie) Get(key []byte) (int, error) {
+	return s.rc.GetReverse(key)
+}
+
+// Delete removes a key, like Cedar.Delete.
+func (s *SuffixTrie) Delete(key []byte) error {
+	return s.rc.DeleteReverse(key)
+}
+
+// Key returns the key of the node `id`, in its natural orientation.
+func (s *SuffixTrie) Key(id int) ([]byte, error) {
+	return s.rc.KeyReverse(id)
+}
+
+// Value returns the value of the node `id`, like Cedar.Value.
+func (s *SuffixTrie) Value(id int) (int, error) {
+	return s.rc.Value(id)
+}
+
+// LongestSuffixMatch returns the node id and the length of the longest
+// key which is a suffix of the text, see ReverseCedar.LongestSuffixMatch.
+func (s *SuffixTrie) LongestSuffixMatch(text []byte) (id, n int, ok bool) {
+	return s.rc.LongestSuffixMatch(text)
+}
+
+// SuffixPredict returns the ids of at most `num` keys ending with
+// the suffix, including the suffix itself, all of them if `num` is 0.
+func (s *SuffixTrie) SuffixPredict(suffix []byte, num int) []int {
+	return s.rc.SuffixPredict(suffix, num)
+}
@@ -0,0 +1,63 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestSuffixTrie(t *testing.T) {
+	s := NewSuffixTrie()
+	domains := []string{"com", "example.com", "www.example.com",
+		"org", "golang.org", "co.uk"}
+	for i, domain := range domains {
+		tt.Nil(t, s.Insert([]byte(domain), i))
+	}
+
+	for i, domain := range domains {
+		value, err := s.Get([]byte(domain))
+		tt.Nil(t, err)
+		tt.Equal(t, i, value)
+	}
+	_, err := s.Get([]byte("moc"))
+	tt.NotNil(t, err)
+
+	match := func(text string) (string, int) {
+		id, n, ok := s.LongestSuffixMatch([]byte(text))
+		if !ok {
+			return "", 0
+		}
+
+		key, err := s.Key(id)
+		tt.Nil(t, err)
+		value, err := s.Value(id)
+		tt.Nil(t, err)
+		tt.Equal(t, string(key), text[len(text)-n:])
+		return string(key), value
+	}
+
+	key, value := match("mail.example.com")
+	tt.Equal(t, "example.com", key)
+	tt.Equal(t, 1, value)
+	key, _ = match("www.example.com")
+	tt.Equal(t, "www.example.com", key)
+	key, _ = match("go.dev.com")
+	tt.Equal(t, "com", key)
+	key, _ = match("bbc.co.uk")
+	tt.Equal(t, "co.uk", key)
+	key, _ = match("example.net")
+	tt.Equal(t, "", key)
+
+	var keys []string
+	for _, id := range s.SuffixPredict([]byte(".com"), 0) {
+		key, err := s.Key(id)
+		tt.Nil(t, err)
+		keys = append(keys, string(key))
+	}
+	tt.Equal(t, []string{"example.com", "www.example.com"}, keys)
+	tt.Equal(t, 1, len(s.SuffixPredict([]byte("com"), 1)))
+
+	tt.Nil(t, s.Delete([]byte("example.com")))
+	key, _ = match("mail.example.com")
+	tt.Equal(t, "com", key)
+}
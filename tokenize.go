@@ -0,0 +1,120 @@
+package cedar
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// TokenizeLongest segments the text by the maximum matching.
+// From each position it emits the longest key which is a prefix of
+// the rest of the text, as text[start:end] with its node id,
+// and goes on after the key. Where no key matches, it skips one
+// UTF-8 character, so a multi-byte character is never split;
+// an invalid byte is skipped alone.
+// For example, if the keys "ab", "abc" and "d" were inserted:
+//
+//	TokenizeLongest([]byte("abcxdab"), emit)
+//
+// emits (0, 3) for "abc", (4, 5) for "d" and (5, 7) for "ab".
+func (da *Cedar) TokenizeLongest(text []byte, emit func(start, end, id int)) {
+	da.tokenizeLongest(text, func(start, end, id, _ int) {
+		emit(start, end, id)
+	})
+}
+
+// TokenizeLongestValue is like TokenizeLongest, but also emits the value
+// of each key, found along with its node, which saves a lookup of
+// the value per token. The value is -1 for the keys added by InsertIn,
+// whose values are read with ValueIn.
+func (da *Cedar) TokenizeLongestValue(text []byte,
+	emit func(start, end, id, value int)) {
+	da.tokenizeLongest(text, emit)
+}
+
+func (da *Cedar) tokenizeLongest(text []byte, emit func(start, end, id, value int)) {
+	for start := 0; start < len(text); {
+		if n, id, to := da.longestPrefix(text[start:]); n > 0 {
+			value := -1
+			if !da.Ninfos[to].End {
+				value = da.decoded(da.Array[to].Value)
+			}
+
+			emit(start, start+n, id, value)
+			start += n
+			continue
+		}
+
+		_, size := utf8.DecodeRune(text[start:])
+		start += size
+	}
+}
+
+// longestPrefix returns the length, the node id and the value node
+// of the longest key which is a prefix of the text, n is 0 if none.
+func (da *Cedar) longestPrefix(text []byte) (n, id, node int) {
+	from := 0
+	for i, b := range text {
+		to, ok := da.Step(from, b)
+		if !ok {
+			break
+		}
+
+		if v, ok := da.valueNode(to); ok {
+			n, id, node = i+1, to, v
+		}
+		from = to
+	}
+
+	return
+}
+
+// MatchAllReader reports every occurrence of every key in the stream
+// read from `r`, as fn(id, start, end) with the node id of the key and
+// its absolute byte offsets in the stream, including the occurrences
+// spanning two reads. The occurrences are reported by end, then by start.
+// It keeps the partial matches still going on between the reads,
+// at most one per byte of the longest key, so it scans streams larger
+// than memory in O(length of the stream * length of the longest key).
+// It returns the error of `r`, other than io.EOF.
+func (da *Cedar) MatchAllReader(r io.Reader, fn func(id, start, end int)) error {
+	type match struct {
+		start, from int
+	}
+
+	var (
+		matches []match
+		buf     = make([]byte, 32<<10)
+		offset  int
+	)
+
+	for {
+		n, err := r.Read(buf)
+		for i, b := range buf[:n] {
+			end := offset + i + 1
+			matches = append(matches, match{start: end - 1})
+
+			going := matches[:0]
+			for _, m := range matches {
+				to, ok := da.Step(m.from, b)
+				if !ok {
+					continue
+				}
+
+				if _, ok := da.valueNode(to); ok {
+					fn(to, m.start, end)
+				}
+				going = append(going, match{start: m.start, from: to})
+			}
+			matches = going
+		}
+		offset += n
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cedar
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestTokenizeLongest(t *testing.T) {
+	c := New()
+	for i, key := range []string{"ab", "abc", "d", "中国", "中国人", "民"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	tokenize := func(text string) (tokens []string, values []int) {
+		c.TokenizeLongest([]byte(text), func(start, end, id int) {
+			tokens = append(tokens, text[start:end])
+
+			value, err := c.Value(id)
+			tt.Nil(t, err)
+			values = append(values, value)
+		})
+		return
+	}
+
+	tokens, values := tokenize("abcxdab")
+	tt.Equal(t, []string{"abc", "d", "ab"}, tokens)
+	tt.Equal(t, []int{1, 2, 0}, values)
+
+	tokens, values = tokenize("我是中国人民a\xffd")
+	tt.Equal(t, []string{"中国人", "民", "d"}, tokens)
+	tt.Equal(t, []int{4, 5, 2}, values)
+
+	tokens, _ = tokenize("abab")
+	tt.Equal(t, []string{"ab", "ab"}, tokens)
+
+	tokens, _ = tokenize("")
+	tt.Equal(t, 0, len(tokens))
+}
+
+func TestTokenizeLongestValue(t *testing.T) {
+	c := New()
+	for i, key := range []string{"ab", "abc", "d"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+	tt.Nil(t, c.InsertIn([]byte("x"), "x"))
+
+	var tokens []string
+	var values []int
+	c.TokenizeLongestValue([]byte("abcxdab"), func(start, end, id, value int) {
+		tokens = append(tokens, string([]byte("abcxdab")[start:end]))
+		values = append(values, value)
+		if value >= 0 {
+			v, err := c.Value(id)
+			tt.Nil(t, err)
+			tt.Equal(t, v, value)
+		}
+	})
+	tt.Equal(t, []string{"abc", "x", "d", "ab"}, tokens)
+	tt.Equal(t, []int{1, -1, 2, 0}, values)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestMatchAllReader(t *testing.T) {
+	c := New()
+	for i, key := range []string{"ab", "abc", "bc", "c", "中国"} {
+		tt.Nil(t, c.Insert([]byte(key), i))
+	}
+
+	const text = "xabcab中国c"
+	match := func(r io.Reader) (matches []string) {
+		err := c.MatchAllReader(r, func(id, start, end int) {
+			key, err := c.Key(id)
+			tt.Nil(t, err)
+			tt.Equal(t, string(key), text[start:end])
+			matches = append(matches, text[start:end])
+		})
+		tt.Nil(t, err)
+		return
+	}
+
+	want := []string{"ab", "abc", "bc", "c", "ab", "中国", "c"}
+	tt.Equal(t, want, match(strings.NewReader(text)))
+	// every match spans the reads of a byte
+	tt.Equal(t, want, match(iotest.OneByteReader(strings.NewReader(text))))
+
+	tt.NotNil(t, c.MatchAllReader(errReader{}, func(id, start, end int) {}))
+}